@@ -0,0 +1,188 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownAccount is returned when an account isn't registered
+var ErrUnknownAccount = errors.New("unknown account")
+
+// Accounts holds clients for several Congress accounts keyed by account
+// name. The options passed to NewAccounts are applied to every client so a
+// transport, rate limiter or metrics collector passed as an option is shared
+// by all accounts. Accounts is safe for concurrent use.
+type Accounts struct {
+	mutex   sync.RWMutex
+	clients map[string]*CongressClient
+	options []Option
+}
+
+// AccountError is the error for a single account in a fan out call.
+type AccountError struct {
+	Account string
+	Err     error
+}
+
+func (a *AccountError) Error() string {
+	return fmt.Sprintf("account %s: %v", a.Account, a.Err)
+}
+
+// Unwrap returns the underlying error
+func (a *AccountError) Unwrap() error {
+	return a.Err
+}
+
+// AccountApplication is an application tagged with its account
+type AccountApplication struct {
+	Account string
+	Application
+}
+
+// AccountGateway is a gateway tagged with its account
+type AccountGateway struct {
+	Account string
+	Gateway
+}
+
+// NewAccounts creates an empty account registry. The options are used for
+// every client created with Add.
+func NewAccounts(options ...Option) *Accounts {
+	return &Accounts{
+		clients: make(map[string]*CongressClient),
+		options: options,
+	}
+}
+
+// Add creates a client for the account and registers it. The options are
+// applied after the shared options. An existing client with the same name
+// is replaced.
+func (a *Accounts) Add(name, token string, options ...Option) (*CongressClient, error) {
+	opts := append(append([]Option(nil), a.options...), options...)
+	client, err := NewCongressClient(token, opts...)
+	if err != nil {
+		return nil, &AccountError{Account: name, Err: err}
+	}
+	a.AddClient(name, client)
+	return client, nil
+}
+
+// AddClient registers an existing client for the account.
+func (a *Accounts) AddClient(name string, client *CongressClient) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.clients[name] = client
+}
+
+// Remove removes the account from the registry.
+func (a *Accounts) Remove(name string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.clients, name)
+}
+
+// Client returns the client for the account.
+func (a *Accounts) Client(name string) (*CongressClient, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	client, ok := a.clients[name]
+	if !ok {
+		return nil, &AccountError{Account: name, Err: ErrUnknownAccount}
+	}
+	return client, nil
+}
+
+// Names returns the sorted list of account names.
+func (a *Accounts) Names() []string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	ret := make([]string, 0, len(a.clients))
+	for name := range a.clients {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Applications returns the applications in all accounts. The accounts are
+// queried concurrently and the result is ordered by account name. If some of
+// the accounts fail the applications from the other accounts are returned
+// together with an error that wraps an AccountError for each failed account.
+func (a *Accounts) Applications(ctx context.Context) ([]AccountApplication, error) {
+	var ret []AccountApplication
+	err := a.fanOut(ctx, func(ctx context.Context, name string, client *CongressClient) (func(), error) {
+		apps, err := client.ApplicationsContext(ctx)
+		return func() {
+			for _, app := range apps {
+				ret = append(ret, AccountApplication{name, app})
+			}
+		}, err
+	})
+	return ret, err
+}
+
+// Gateways returns the gateways in all accounts. See Applications for the
+// ordering and error handling.
+func (a *Accounts) Gateways(ctx context.Context) ([]AccountGateway, error) {
+	var ret []AccountGateway
+	err := a.fanOut(ctx, func(ctx context.Context, name string, client *CongressClient) (func(), error) {
+		gws, err := client.GatewaysContext(ctx)
+		return func() {
+			for _, gw := range gws {
+				ret = append(ret, AccountGateway{name, gw})
+			}
+		}, err
+	})
+	return ret, err
+}
+
+// Call fn concurrently for every account. fn returns a function that
+// collects the result; the collect functions are called sequentially in
+// account order once all calls are done.
+func (a *Accounts) fanOut(ctx context.Context, fn func(context.Context, string, *CongressClient) (func(), error)) error {
+	names := a.Names()
+	collect := make([]func(), len(names))
+	errs := make([]error, len(names))
+	wg := sync.WaitGroup{}
+	for i, name := range names {
+		client, err := a.Client(name)
+		if err != nil {
+			// Removed while we were working
+			continue
+		}
+		wg.Add(1)
+		go func(i int, name string, client *CongressClient) {
+			defer wg.Done()
+			var err error
+			if collect[i], err = fn(ctx, name, client); err != nil {
+				errs[i] = &AccountError{Account: name, Err: err}
+			}
+		}(i, name, client)
+	}
+	wg.Wait()
+	for i := range names {
+		if errs[i] == nil && collect[i] != nil {
+			collect[i]()
+		}
+	}
+	return errors.Join(errs...)
+}
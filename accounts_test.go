@@ -0,0 +1,73 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccounts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(tokenHeader)
+		if token == "bad" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `{"applications":[{"applicationEUI":"%s-1"},{"applicationEUI":"%s-2"}]}`, token, token)
+	}))
+	defer server.Close()
+
+	limiter := NewRateLimiter(RateLimits{})
+	accounts := NewAccounts(WithAddr(server.URL), WithoutPing(), WithRateLimiter(limiter))
+	for _, name := range []string{"b", "a", "c"} {
+		token := name
+		if name == "c" {
+			token = "bad"
+		}
+		if _, err := accounts.Add(name, token); err != nil {
+			t.Fatalf("Got error adding account %s: %v", name, err)
+		}
+	}
+
+	apps, err := accounts.Applications(context.Background())
+	var accountErr *AccountError
+	if !errors.As(err, &accountErr) || accountErr.Account != "c" || !errors.Is(err, ErrForbidden) {
+		t.Fatalf("Expected error for account c but got %v", err)
+	}
+	if len(apps) != 4 {
+		t.Fatalf("Expected 4 applications but got %d", len(apps))
+	}
+	if apps[0].Account != "a" || apps[0].EUI != "a-1" || apps[3].Account != "b" || apps[3].EUI != "b-2" {
+		t.Fatalf("Applications aren't tagged and ordered correctly: %+v", apps)
+	}
+	if stats := limiter.Stats(ReadLimit); stats.Requests != 3 {
+		t.Fatalf("Rate limiter isn't shared. Stats: %+v", stats)
+	}
+
+	if _, err := accounts.Client("unknown"); !errors.Is(err, ErrUnknownAccount) {
+		t.Fatalf("Expected ErrUnknownAccount but got %v", err)
+	}
+	accounts.Remove("c")
+	if _, err := accounts.Applications(context.Background()); err != nil {
+		t.Fatalf("Got error after removing account: %v", err)
+	}
+}
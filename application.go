@@ -18,12 +18,9 @@ package gocongress
  */
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"net/url"
-	"time"
-
-	"golang.org/x/net/websocket"
 )
 
 // Application is the type that represent an application in Congress. LoRa
@@ -33,6 +30,7 @@ type Application struct {
 	EUI string `json:"applicationEUI,omitempty"`
 	tagResource
 	client *CongressClient
+	rev    entityRevision
 }
 
 // AppOutput is an application output
@@ -44,6 +42,7 @@ type AppOutput struct {
 	Status string                 `json:"status,omitempty"`
 	app    *Application
 	client *CongressClient
+	rev    entityRevision
 }
 
 // OutputLog is the log from the output
@@ -123,134 +122,140 @@ func (m *MQTTConfig) ReadFromMap(vals map[string]interface{}) {
 // Update updates the application in the Congress backend. The updated application
 // is returned.
 func (app *Application) Update() (*Application, error) {
-	res, err := app.client.genericMutation(http.MethodPut, fmt.Sprintf("/applications/%s", app.EUI), app)
-	if res == nil {
-		return nil, err
-	}
-	return res.(*Application), err
+	return app.UpdateContext(context.Background())
+}
+
+// UpdateContext updates the application in the Congress backend using the
+// provided context. The updated application is returned.
+func (app *Application) UpdateContext(ctx context.Context) (*Application, error) {
+	return genericMutation(ctx, app.client, "Application.Update", http.MethodPut, fmt.Sprintf("/applications/%s", app.EUI), app)
 }
 
 // Delete removes the application from Congress
 func (app *Application) Delete() error {
-	return app.client.genericDelete(fmt.Sprintf("/applications/%s", app.EUI))
+	return app.DeleteContext(context.Background())
+}
+
+// DeleteContext removes the application from Congress using the provided context
+func (app *Application) DeleteContext(ctx context.Context) error {
+	return app.client.genericDelete(ctx, "Application.Delete", fmt.Sprintf("/applications/%s", app.EUI))
 }
 
 // NewDevice creates a new OTAA (Over-The-Air-Activated) device in Congress.
 // The AppKey and EUI are automatically generated by the Congress backend.
 func (app *Application) NewDevice(dt DeviceType) (*Device, error) {
-	device := &Device{"", "", "", "", "", 0, 0, false, "", false, newTags(), app.client, app}
+	return app.NewDeviceContext(context.Background(), dt)
+}
+
+// NewDeviceContext creates a new device in Congress using the provided context.
+func (app *Application) NewDeviceContext(ctx context.Context, dt DeviceType) (*Device, error) {
+	device := &Device{"", "", "", "", "", 0, 0, false, "", false, newTags(), app.client, app, entityRevision{}}
 	if dt == OTAA {
 		device.DeviceType = "OTAA"
 	} else {
 		device.DeviceType = "ABP"
 	}
-	ret, err := app.client.genericMutation(http.MethodPost, fmt.Sprintf("/applications/%s/devices", app.EUI), device)
+	ret, err := genericMutation(ctx, app.client, "Application.NewDevice", http.MethodPost, fmt.Sprintf("/applications/%s/devices", app.EUI), device)
 	if err != nil {
 		return nil, err
 	}
-	return ret.(*Device), nil
+	return ret, nil
 }
 
 // Outputs returns the list of configured outputs
 func (app *Application) Outputs() ([]AppOutput, error) {
+	return app.OutputsContext(context.Background())
+}
+
+// OutputsContext returns the list of configured outputs using the provided context
+func (app *Application) OutputsContext(ctx context.Context) ([]AppOutput, error) {
 	type outputList struct {
 		Outputs []AppOutput `json:"outputs"`
 	}
-	list, err := app.client.genericGet(fmt.Sprintf("/applications/%s/outputs", app.EUI), &outputList{})
+	list, err := genericGet(ctx, app.client, "Application.Outputs", fmt.Sprintf("/applications/%s/outputs", app.EUI), &outputList{})
 	if err != nil {
 		return nil, err
 	}
-	return list.(*outputList).Outputs, nil
+	outputs := list.Outputs
+	for i := range outputs {
+		outputs[i].app = app
+		outputs[i].client = app.client
+		app.client.trackRevision(&outputs[i], "")
+	}
+	return outputs, nil
 }
 
 // Devices returns the device list for the application
 func (app *Application) Devices() ([]Device, error) {
+	return app.DevicesContext(context.Background())
+}
+
+// DevicesContext returns the device list for the application using the
+// provided context
+func (app *Application) DevicesContext(ctx context.Context) ([]Device, error) {
 	type deviceList struct {
 		Devices []Device `json:"devices"`
 	}
-	list, err := app.client.genericGet(fmt.Sprintf("/applications/%s/devices", app.EUI), &deviceList{})
+	list, err := genericGet(ctx, app.client, "Application.Devices", fmt.Sprintf("/applications/%s/devices", app.EUI), &deviceList{})
+	if err != nil {
+		return nil, err
+	}
+	devices := list.Devices
+	for i := range devices {
+		devices[i].app = app
+		devices[i].client = app.client
+		app.client.trackRevision(&devices[i], "")
+	}
+	return devices, nil
+}
+
+// GetDevice retrieves a device in the application
+func (app *Application) GetDevice(eui string) (*Device, error) {
+	return app.GetDeviceContext(context.Background(), eui)
+}
+
+// GetDeviceContext retrieves a device in the application using the provided
+// context
+func (app *Application) GetDeviceContext(ctx context.Context, eui string) (*Device, error) {
+	device := &Device{tagResource: newTags(), client: app.client, app: app}
+	ret, err := genericGet(ctx, app.client, "Application.GetDevice", fmt.Sprintf("/applications/%s/devices/%s", app.EUI, eui), device)
 	if err != nil {
 		return nil, err
 	}
-	return list.(*deviceList).Devices, nil
+	return ret, nil
 }
 
 // NewOutput creates a new application output
 func (app *Application) NewOutput(config OutputConfig) (*AppOutput, error) {
+	return app.NewOutputContext(context.Background(), config)
+}
+
+// NewOutputContext creates a new application output using the provided context
+func (app *Application) NewOutputContext(ctx context.Context, config OutputConfig) (*AppOutput, error) {
 	output := &AppOutput{Config: config.Config(), app: app, client: app.client}
-	ret, err := app.client.genericMutation(http.MethodPost, fmt.Sprintf("/applications/%s/outputs", app.EUI), output)
+	ret, err := genericMutation(ctx, app.client, "Application.NewOutput", http.MethodPost, fmt.Sprintf("/applications/%s/outputs", app.EUI), output)
 	if err != nil {
 		return nil, err
 	}
-	return ret.(*AppOutput), nil
+	return ret, nil
 }
 
 // Update updates the application output
 func (output *AppOutput) Update() (*AppOutput, error) {
-	res, err := output.client.genericMutation(http.MethodPut, fmt.Sprintf("/applications/%s/outputs/%s", output.app.EUI, output.EUI), output)
-	if res == nil {
-		return nil, err
-	}
-	return res.(*AppOutput), err
+	return output.UpdateContext(context.Background())
+}
+
+// UpdateContext updates the application output using the provided context
+func (output *AppOutput) UpdateContext(ctx context.Context) (*AppOutput, error) {
+	return genericMutation(ctx, output.client, "AppOutput.Update", http.MethodPut, fmt.Sprintf("/applications/%s/outputs/%s", output.app.EUI, output.EUI), output)
 }
 
 // Delete removes the application output
 func (output *AppOutput) Delete() error {
-	return output.client.genericDelete(fmt.Sprintf("/applications/%s/outputs/%s", output.app.EUI, output.EUI))
+	return output.DeleteContext(context.Background())
 }
 
-// DataErrorMessage are error messages generated by the data stream.
-type DataErrorMessage string
-
-// DataStream returns a channel with device data using the appliction's web
-// socket. If there's an error reading the web socket the channel will be closed.
-// Error messages are sent on the error channel that is returned.
-func (app *Application) DataStream() (chan DataMessage, chan DataErrorMessage, error) {
-
-	congressURL, err := url.Parse(app.client.Addr)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	wscfg, err := websocket.NewConfig(fmt.Sprintf("wss://%s/applications/%s/stream", congressURL.Host, app.EUI), "http://example.com")
-	if err != nil {
-		return nil, nil, err
-	}
-	wscfg.Header.Set(tokenHeader, app.client.Token)
-
-	ws, err := websocket.DialConfig(wscfg)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	ret := make(chan DataMessage)
-	errors := make(chan DataErrorMessage)
-	go func() {
-		defer ws.Close()
-		defer close(ret)
-		defer close(errors)
-		for {
-			data := socketData{}
-			err := websocket.JSON.Receive(ws, &data)
-			if err != nil {
-				errors <- DataErrorMessage(fmt.Sprintf("%v", err))
-				return
-			}
-			switch data.MsgType {
-			case "DeviceData":
-				select {
-				case ret <- data.Data:
-				case <-time.After(400 * time.Millisecond):
-					errors <- DataErrorMessage("Timed out writing to socket")
-					return
-				}
-			case "Error":
-
-				return
-			default:
-				// Ignore it
-			}
-		}
-	}()
-	return ret, errors, nil
+// DeleteContext removes the application output using the provided context
+func (output *AppOutput) DeleteContext(ctx context.Context) error {
+	return output.client.genericDelete(ctx, "AppOutput.Delete", fmt.Sprintf("/applications/%s/outputs/%s", output.app.EUI, output.EUI))
 }
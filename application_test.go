@@ -17,7 +17,10 @@ package gocongress
  */
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -167,7 +170,7 @@ func TestAppOutput(t *testing.T) {
 
 // Test the websocket output. There's no easy way to generate output
 func TestWebsocketOutput(t *testing.T) {
-	client, _ := NewCongressClientWithAddr(*addr, *token)
+	client, _ := NewCongressClient(*token, WithAddr(*addr), WithInsecureStream())
 	app, _ := client.NewApplication()
 	d1, _ := app.NewDevice(OTAA)
 	d2, _ := app.NewDevice(ABP)
@@ -187,3 +190,39 @@ func TestWebsocketOutput(t *testing.T) {
 
 	app.Delete()
 }
+
+// Serve a static JSON document so the benchmarks measure the client
+func benchmarkServer(b *testing.B, doc interface{}) *httptest.Server {
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		b.Fatalf("Couldn't encode document: %v", err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf)
+	}))
+}
+
+// Most of the allocations are the strings decoded by encoding/json, so the
+// list benchmarks mainly show the cost per request on a reused connection
+func BenchmarkDevices(b *testing.B) {
+	devices := make([]Device, 2000)
+	for i := range devices {
+		devices[i] = Device{EUI: fmt.Sprintf("00-00-00-00-00-00-%02x-%02x", i>>8, i&0xff), DeviceType: "OTAA", ApplicationKey: "000102030405060708090a0b0c0d0e0f", tagResource: newTags()}
+	}
+	server := benchmarkServer(b, map[string]interface{}{"devices": devices})
+	defer server.Close()
+
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing())
+	if err != nil {
+		b.Fatalf("Got error creating client: %v", err)
+	}
+	app := &Application{EUI: "00-01", tagResource: newTags(), client: client}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := app.Devices(); err != nil {
+			b.Fatalf("Got error retrieving devices: %v", err)
+		}
+	}
+}
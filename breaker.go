@@ -0,0 +1,207 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when the circuit breaker is open and requests
+// aren't sent to Congress.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of the circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed is the normal state where requests are sent
+	BreakerClosed BreakerState = iota
+	// BreakerOpen is the state where requests fail with ErrCircuitOpen
+	BreakerOpen
+	// BreakerHalfOpen is the state where the breaker probes Congress with
+	// Ping to see if it has recovered
+	BreakerHalfOpen
+)
+
+// String returns the name of the state
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig configures the circuit breaker. Network errors and 5xx
+// responses are counted as failures.
+type BreakerConfig struct {
+	// FailureRate is the fraction (0-1] of failed requests in a window
+	// that opens the breaker
+	FailureRate float64
+	// MinRequests is the number of requests in a window before the failure
+	// rate is checked
+	MinRequests int
+	// Window is the length of the window the failures are counted in
+	Window time.Duration
+	// OpenTimeout is the time the breaker stays open before Congress is
+	// probed
+	OpenTimeout time.Duration
+	// OnStateChange is called when the breaker changes state. It is called
+	// from the goroutine that caused the change after the breaker is
+	// unlocked, so it may use the client, but it must not block.
+	OnStateChange func(from, to BreakerState)
+}
+
+// WithCircuitBreaker adds a circuit breaker to the client. Requests fail
+// with ErrCircuitOpen while the breaker is open, and data streams don't
+// dial Congress when they reconnect. When OpenTimeout has passed the breaker
+// goes half open and pings Congress in the background; the breaker closes if
+// the ping succeeds.
+func WithCircuitBreaker(config BreakerConfig) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.breaker = &circuitBreaker{config: config, client: c}
+	}
+}
+
+// BreakerState returns the state of the circuit breaker. Clients without a
+// breaker are always closed.
+func (c *CongressClient) BreakerState() BreakerState {
+	if c.breaker == nil {
+		return BreakerClosed
+	}
+	c.breaker.mutex.Lock()
+	defer c.breaker.mutex.Unlock()
+	return c.breaker.state
+}
+
+type probeKey struct{}
+
+// The circuit breaker. The methods are safe to use on a nil breaker.
+type circuitBreaker struct {
+	mutex       sync.Mutex
+	config      BreakerConfig
+	client      *CongressClient
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+}
+
+// Check if a request can be sent
+func (b *circuitBreaker) allow(ctx context.Context) error {
+	if b == nil || ctx.Value(probeKey{}) != nil {
+		return nil
+	}
+	var change stateChange
+	defer func() { change.notify() }()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		return nil
+	case BreakerOpen:
+		if time.Since(b.openedAt) >= b.config.OpenTimeout {
+			change = b.setState(BreakerHalfOpen)
+			go b.probe()
+		}
+	}
+	return ErrCircuitOpen
+}
+
+// Record the result of a request
+func (b *circuitBreaker) record(ctx context.Context, resp *http.Response, err error) {
+	if b == nil || ctx.Value(probeKey{}) != nil {
+		return
+	}
+	failed := (err != nil && ctx.Err() == nil) || (resp != nil && resp.StatusCode >= 500)
+	var change stateChange
+	defer func() { change.notify() }()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state != BreakerClosed {
+		return
+	}
+	now := time.Now()
+	if now.Sub(b.windowStart) > b.config.Window {
+		b.windowStart = now
+		b.requests = 0
+		b.failures = 0
+	}
+	b.requests++
+	if failed {
+		b.failures++
+	}
+	if b.requests >= b.config.MinRequests && float64(b.failures) >= b.config.FailureRate*float64(b.requests) && b.failures > 0 {
+		b.openedAt = now
+		change = b.setState(BreakerOpen)
+	}
+}
+
+// Ping Congress and close the breaker if it responds
+func (b *circuitBreaker) probe() {
+	ctx := context.WithValue(context.Background(), probeKey{}, true)
+	if b.config.OpenTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.config.OpenTimeout)
+		defer cancel()
+	}
+	err := b.client.PingContext(ctx)
+
+	var change stateChange
+	defer func() { change.notify() }()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err != nil && !errors.Is(err, ErrUnauthorized) && !errors.Is(err, ErrForbidden) {
+		b.openedAt = time.Now()
+		change = b.setState(BreakerOpen)
+		return
+	}
+	b.windowStart = time.Now()
+	b.requests = 0
+	b.failures = 0
+	change = b.setState(BreakerClosed)
+}
+
+// Change the state. The mutex must be held. The returned change is
+// notified once the mutex is released.
+func (b *circuitBreaker) setState(state BreakerState) stateChange {
+	change := stateChange{from: b.state, to: state, callback: b.config.OnStateChange}
+	b.state = state
+	return change
+}
+
+// A state change to report to the OnStateChange callback
+type stateChange struct {
+	from, to BreakerState
+	callback func(from, to BreakerState)
+}
+
+func (s stateChange) notify() {
+	if s.callback != nil && s.from != s.to {
+		s.callback(s.from, s.to)
+	}
+}
@@ -0,0 +1,135 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy int32
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"gateways":[]}`))
+	}))
+	defer server.Close()
+
+	mutex := sync.Mutex{}
+	var changes []BreakerState
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithCircuitBreaker(BreakerConfig{
+		FailureRate: 0.5,
+		MinRequests: 3,
+		Window:      time.Minute,
+		OpenTimeout: 50 * time.Millisecond,
+		OnStateChange: func(from, to BreakerState) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			changes = append(changes, to)
+		},
+	}))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Gateways(); !errors.Is(err, ErrServer) {
+			t.Fatalf("Expected server error but got %v", err)
+		}
+	}
+	if client.BreakerState() != BreakerOpen {
+		t.Fatalf("Expected breaker to be open but it is %v", client.BreakerState())
+	}
+	if _, err := client.Gateways(); !errors.Is(err, ErrCircuitOpen) || requests != 3 {
+		t.Fatalf("Expected fail fast but got %v after %d requests", err, requests)
+	}
+
+	// The breaker closes when the probe succeeds
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := client.Gateways(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected request that starts the probe to fail fast but got %v", err)
+	}
+	// Wait for the callback since it runs after the state has changed
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		mutex.Lock()
+		n := len(changes)
+		mutex.Unlock()
+		if n == 3 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := client.Gateways(); err != nil {
+		t.Fatalf("Expected request to succeed after probe but got %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	expected := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(changes) != len(expected) {
+		t.Fatalf("Unexpected state changes: %v", changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatalf("Unexpected state changes: %v", changes)
+		}
+	}
+}
+
+func TestBreakerCallbackUsesClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	states := make(chan BreakerState, 1)
+	var client *CongressClient
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithCircuitBreaker(BreakerConfig{
+		FailureRate: 1,
+		MinRequests: 1,
+		Window:      time.Minute,
+		OpenTimeout: time.Minute,
+		OnStateChange: func(from, to BreakerState) {
+			states <- client.BreakerState()
+		},
+	}))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+
+	go client.Gateways()
+	select {
+	case state := <-states:
+		if state != BreakerOpen {
+			t.Fatalf("Expected the callback to see the open breaker but got %v", state)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The callback deadlocked reading the breaker state")
+	}
+}
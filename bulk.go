@@ -0,0 +1,197 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// DefaultBulkConcurrency is the number of concurrent requests used by bulk
+// operations unless BulkOptions says otherwise
+const DefaultBulkConcurrency = 8
+
+// ErrSkipped is the error for items that weren't attempted because a fail
+// fast bulk operation stopped.
+var ErrSkipped = errors.New("skipped after an earlier error")
+
+// BulkOptions configures a bulk operation. The requests go through the
+// client as usual so the rate limiter, retries and circuit breaker apply to
+// each of them.
+type BulkOptions struct {
+	// Concurrency is the number of requests in flight at once. It defaults
+	// to DefaultBulkConcurrency.
+	Concurrency int
+	// FailFast stops the operation at the first error. Requests in flight
+	// are cancelled and the items that haven't been started get ErrSkipped.
+	// If the operation's context is done first, the items that haven't been
+	// started get the context's cause whether FailFast is set or not.
+	FailFast bool
+	// Progress is called when an item is done. It is never called
+	// concurrently.
+	Progress func(progress BulkProgress)
+}
+
+// BulkProgress is reported to the progress callback when an item is done
+type BulkProgress struct {
+	// Index is the index of the item that is done
+	Index int
+	// Err is the item's error, if any
+	Err error
+	// Done is the number of items that are done, including this one
+	Done int
+	// Failed is the number of items that have failed so far
+	Failed int
+	// Total is the number of items in the operation
+	Total int
+}
+
+// BulkResult is the result of a single item in a bulk operation. The
+// results are in the same order as the items.
+type BulkResult[T any] struct {
+	Index  int
+	Result T
+	Err    error
+}
+
+// BulkError joins the errors in the results. It returns nil if all the
+// items succeeded.
+func BulkError[T any](results []BulkResult[T]) error {
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("item %d: %w", result.Index, result.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// BulkCreateDevices creates the devices in the application. The EUI, keys,
+// tags and the other fields of each device are sent as is; empty fields are
+// generated by Congress. The created devices are returned in the results.
+func (app *Application) BulkCreateDevices(ctx context.Context, devices []Device, opts BulkOptions) []BulkResult[*Device] {
+	return runBulk(ctx, devices, opts, func(ctx context.Context, device Device) (*Device, error) {
+		device.client = app.client
+		device.app = app
+		device.rev = entityRevision{}
+		// The response is decoded into the device so it can't share the
+		// tags with the caller's device
+		device.Tags = copyTags(device.Tags)
+		ret, err := genericMutation(ctx, app.client, "Application.NewDevice", http.MethodPost, fmt.Sprintf("/applications/%s/devices", app.EUI), &device)
+		if err != nil {
+			return nil, err
+		}
+		return ret, nil
+	})
+}
+
+// BulkUpdate updates the entities, f.e. devices or gateways. The updated
+// entities are returned in the results.
+func BulkUpdate[T interface {
+	UpdateContext(ctx context.Context) (T, error)
+}](ctx context.Context, items []T, opts BulkOptions) []BulkResult[T] {
+	return runBulk(ctx, items, opts, func(ctx context.Context, item T) (T, error) {
+		return item.UpdateContext(ctx)
+	})
+}
+
+// BulkDelete removes the entities, f.e. devices or gateways. The results
+// hold the entities that were removed.
+func BulkDelete[T interface {
+	DeleteContext(ctx context.Context) error
+}](ctx context.Context, items []T, opts BulkOptions) []BulkResult[T] {
+	return runBulk(ctx, items, opts, func(ctx context.Context, item T) (T, error) {
+		return item, item.DeleteContext(ctx)
+	})
+}
+
+// Run the operation on the items with a pool of workers
+func runBulk[T, R any](parent context.Context, items []T, opts BulkOptions, op func(context.Context, T) (R, error)) []BulkResult[R] {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	results := make([]BulkResult[R], len(items))
+	for i := range results {
+		results[i] = BulkResult[R]{Index: i, Err: ErrSkipped}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBulkConcurrency
+	}
+
+	var mutex sync.Mutex
+	done, failed := 0, 0
+	// Set when an item failed before the parent context was done
+	stopped := false
+	finish := func(i int, result R, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[i].Result = result
+		results[i].Err = err
+		done++
+		if err != nil {
+			failed++
+			if opts.FailFast && parent.Err() == nil {
+				stopped = true
+				cancel()
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(BulkProgress{Index: i, Err: err, Done: done, Failed: failed, Total: len(items)})
+		}
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(concurrency, len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result, err := op(ctx, items[i])
+				finish(i, result, err)
+			}
+		}()
+	}
+	func() {
+		defer close(indexes)
+		for i := range items {
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if err := context.Cause(parent); err != nil && !stopped {
+		// The items that weren't started get the error of the context
+		for i := range results {
+			if results[i].Err == ErrSkipped {
+				results[i].Err = err
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,191 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gregersrygg/gocongress/congresstest"
+)
+
+// Track the highest number of calls in flight
+func inFlight(current, highest *atomic.Int32) Middleware {
+	return func(next Handler) Handler {
+		return func(call *Call) error {
+			n := current.Add(1)
+			defer current.Add(-1)
+			for {
+				max := highest.Load()
+				if n <= max || highest.CompareAndSwap(max, n) {
+					break
+				}
+			}
+			return next(call)
+		}
+	}
+}
+
+func TestBulk(t *testing.T) {
+	server := congresstest.NewServer("")
+	defer server.Close()
+	var current, highest atomic.Int32
+	limiter := NewRateLimiter(RateLimits{Read: RateLimit{Rate: 1000, Burst: 10}, Mutation: RateLimit{Rate: 1000, Burst: 10}})
+	client, err := NewCongressClient("", WithAddr(server.URL), WithRateLimiter(limiter), WithMiddleware(inFlight(&current, &highest)))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	slow := server.AddFault(congresstest.Fault{Latency: 5 * time.Millisecond})
+
+	templates := make([]Device, 40)
+	for i := range templates {
+		templates[i] = Device{DeviceType: "ABP", tagResource: newTags()}
+		templates[i].SetTag("index", fmt.Sprint(i))
+	}
+	var progress []int
+	created := app.BulkCreateDevices(context.Background(), templates, BulkOptions{
+		Concurrency: 4,
+		Progress: func(p BulkProgress) {
+			progress = append(progress, p.Done)
+		},
+	})
+	if err := BulkError(created); err != nil {
+		t.Fatalf("Got error creating devices: %v", err)
+	}
+	if highest.Load() > 4 {
+		t.Fatalf("Expected at most 4 requests in flight but got %d", highest.Load())
+	}
+	if len(progress) != 40 || progress[39] != 40 {
+		t.Fatalf("Unexpected progress: %v", progress)
+	}
+	if limiter.Stats(MutationLimit).Requests < 40 {
+		t.Fatal("Requests didn't go through the rate limiter")
+	}
+	devices := make([]*Device, len(created))
+	for i, result := range created {
+		if result.Index != i || result.Result.GetTag("index") != fmt.Sprint(i) || result.Result.NetworkSessionKey == "" {
+			t.Fatalf("Unexpected result %d: %+v", i, result.Result)
+		}
+		if templates[i].GetTag("index") != fmt.Sprint(i) || templates[i].EUI != "" {
+			t.Fatal("Bulk create modified the templates")
+		}
+		devices[i] = result.Result
+		devices[i].SetTag("name", "bulk")
+	}
+
+	updated := BulkUpdate(context.Background(), devices, BulkOptions{Concurrency: 8})
+	if err := BulkError(updated); err != nil {
+		t.Fatalf("Got error updating devices: %v", err)
+	}
+	if device, _ := app.GetDevice(devices[10].EUI); device.GetTag("name") != "bulk" {
+		t.Fatal("Device wasn't updated")
+	}
+
+	// Fail on the third delete and continue
+	slow()
+	remove := server.AddFault(congresstest.Fault{Method: http.MethodDelete, Path: "/applications/*/devices/" + devices[2].EUI, StatusCode: http.StatusForbidden})
+	deleted := BulkDelete(context.Background(), devices, BulkOptions{})
+	if err := BulkError(deleted); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("Expected forbidden error but got %v", err)
+	}
+	for i, result := range deleted {
+		if (i == 2) != (result.Err != nil) {
+			t.Fatalf("Unexpected result for item %d: %v", i, result.Err)
+		}
+	}
+	remove()
+	if remaining, _ := app.Devices(); len(remaining) != 1 {
+		t.Fatalf("Expected one device left but got %d", len(remaining))
+	}
+}
+
+func TestBulkFailFast(t *testing.T) {
+	server := congresstest.NewServer("")
+	defer server.Close()
+	client, err := NewCongressClient("", WithAddr(server.URL))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	server.AddFault(congresstest.Fault{Method: http.MethodPost, Path: "/applications/*/devices", StatusCode: http.StatusBadRequest})
+
+	results := app.BulkCreateDevices(context.Background(), make([]Device, 100), BulkOptions{Concurrency: 2, FailFast: true})
+	skipped := 0
+	for _, result := range results {
+		if errors.Is(result.Err, ErrSkipped) {
+			skipped++
+		}
+	}
+	if skipped < 90 {
+		t.Fatalf("Expected most items to be skipped but %d were", skipped)
+	}
+	if devices, _ := app.Devices(); len(devices) != 0 {
+		t.Fatalf("Expected no devices but got %d", len(devices))
+	}
+}
+
+func TestBulkCancelled(t *testing.T) {
+	server := congresstest.NewServer("")
+	defer server.Close()
+	client, err := NewCongressClient("", WithAddr(server.URL))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+
+	cause := errors.New("shutting down")
+	for _, failFast := range []bool{false, true} {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		opts := BulkOptions{Concurrency: 1, FailFast: failFast, Progress: func(progress BulkProgress) {
+			if progress.Done == 2 {
+				cancel(cause)
+			}
+		}}
+		devices := make([]Device, 20)
+		for i := range devices {
+			devices[i].DeviceType = "OTAA"
+		}
+		results := app.BulkCreateDevices(ctx, devices, opts)
+		cancelled := 0
+		for _, result := range results {
+			if errors.Is(result.Err, ErrSkipped) {
+				t.Fatalf("Item %d was skipped with FailFast=%v", result.Index, failFast)
+			}
+			if errors.Is(result.Err, cause) {
+				cancelled++
+			}
+		}
+		if cancelled < 17 {
+			t.Fatalf("Expected the unstarted items to get the cause with FailFast=%v but %d did", failFast, cancelled)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig configures the response cache. A TTL of zero disables caching
+// for that kind of resource.
+type CacheConfig struct {
+	// Applications is the TTL for the application list and single
+	// applications
+	Applications time.Duration
+	// Devices is the TTL for device lists
+	Devices time.Duration
+	// Gateways is the TTL for the gateway list and single gateways
+	Gateways time.Duration
+	// MaxEntries is the maximum number of cached responses. The least
+	// recently used response is evicted when the cache is full. The default
+	// is 1000.
+	MaxEntries int
+}
+
+// CacheStats is the statistics for the response cache.
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int
+}
+
+// WithCache adds an in-memory cache for Applications, GetApplication,
+// Devices, Gateways and GetGateway. Every response is decoded into a new
+// entity so callers can't modify cached entities. Mutations made through the
+// client invalidate the cached responses for the resource, its parents and
+// its children. Changes made by other clients are visible when the TTL has
+// expired.
+func WithCache(config CacheConfig) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		if config.MaxEntries <= 0 {
+			config.MaxEntries = 1000
+		}
+		c.cache = &responseCache{
+			config:  config,
+			entries: make(map[string]*list.Element),
+			lru:     list.New(),
+		}
+	}
+}
+
+type noCacheKey struct{}
+
+// NoCache returns a context that makes requests bypass the response cache.
+// The response is still stored in the cache.
+func NoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// CacheStats returns the statistics for the response cache. The statistics
+// are empty if the client has no cache.
+func (c *CongressClient) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	c.cache.mutex.Lock()
+	defer c.cache.mutex.Unlock()
+	stats := c.cache.stats
+	stats.Entries = c.cache.lru.Len()
+	return stats
+}
+
+// An LRU cache of response bodies keyed by path. The methods are safe to
+// use on a nil cache.
+type responseCache struct {
+	mutex   sync.Mutex
+	config  CacheConfig
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	path    string
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// Find the TTL for a path. Only the paths used by Applications,
+// GetApplication, Devices, Gateways and GetGateway are cached.
+func (r *responseCache) ttl(path string) time.Duration {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case parts[0] == "applications" && len(parts) <= 2:
+		return r.config.Applications
+	case parts[0] == "applications" && len(parts) == 3 && parts[2] == "devices":
+		return r.config.Devices
+	case parts[0] == "gateways" && len(parts) <= 2:
+		return r.config.Gateways
+	}
+	return 0
+}
+
+// Check if the response for the call should be cached
+func (r *responseCache) cacheable(call *Call) bool {
+	return r != nil && call.Request.Method == http.MethodGet && call.Request.URL.RawQuery == "" && r.ttl(call.Request.URL.Path) > 0
+}
+
+// Look up the response for the call
+func (r *responseCache) lookup(call *Call) (cacheEntry, bool) {
+	if !r.cacheable(call) {
+		return cacheEntry{}, false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if bypass, _ := call.Request.Context().Value(noCacheKey{}).(bool); bypass {
+		r.stats.Misses++
+		return cacheEntry{}, false
+	}
+	elem, ok := r.entries[call.Request.URL.Path]
+	if !ok {
+		r.stats.Misses++
+		return cacheEntry{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		r.remove(elem)
+		r.stats.Misses++
+		return cacheEntry{}, false
+	}
+	r.lru.MoveToFront(elem)
+	r.stats.Hits++
+	return *entry, true
+}
+
+// Store the response for the call
+func (r *responseCache) store(call *Call, body []byte, etag string) {
+	path := call.Request.URL.Path
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if elem, ok := r.entries[path]; ok {
+		r.remove(elem)
+	}
+	entry := &cacheEntry{path: path, body: body, etag: etag, expires: time.Now().Add(r.ttl(path))}
+	r.entries[path] = r.lru.PushFront(entry)
+	for r.lru.Len() > r.config.MaxEntries {
+		r.remove(r.lru.Back())
+		r.stats.Evictions++
+	}
+}
+
+// Remove the cached responses for the path, its parents and its children
+func (r *responseCache) invalidate(path string) {
+	if r == nil {
+		return
+	}
+	path = strings.TrimSuffix(path, "/")
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for key, elem := range r.entries {
+		if key == path || strings.HasPrefix(path, key+"/") || strings.HasPrefix(key, path+"/") {
+			r.remove(elem)
+		}
+	}
+}
+
+// Remove an element. The mutex must be held.
+func (r *responseCache) remove(elem *list.Element) {
+	r.lru.Remove(elem)
+	delete(r.entries, elem.Value.(*cacheEntry).path)
+}
@@ -0,0 +1,81 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/applications":
+			fmt.Fprintf(w, `{"applications":[{"applicationEUI":"00-01","tags":{"n":"%d"}}]}`, n)
+		case "/gateways/00-02", "/gateways/00-03":
+			fmt.Fprintf(w, `{"gatewayEUI":"%s"}`, r.URL.Path[len("/gateways/"):])
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithCache(CacheConfig{
+		Applications: time.Minute,
+		Gateways:     time.Minute,
+		MaxEntries:   2,
+	}))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+
+	first, _ := client.Applications()
+	first[0].SetTag("n", "modified")
+	second, _ := client.Applications()
+	if requests != 1 || second[0].GetTag("n") != "1" {
+		t.Fatalf("Expected cached, unmodified response. Requests: %d, tag: %s", requests, second[0].GetTag("n"))
+	}
+
+	// Bypassing the cache sends a new request
+	if _, err := client.ApplicationsContext(NoCache(context.Background())); err != nil || requests != 2 {
+		t.Fatalf("Expected request to bypass the cache. Requests: %d (%v)", requests, err)
+	}
+
+	// Updating an application invalidates the list
+	if _, err := second[0].Update(); err != nil {
+		t.Fatalf("Got error updating application: %v", err)
+	}
+	client.Applications()
+	if requests != 4 {
+		t.Fatalf("Expected list to be invalidated. Requests: %d", requests)
+	}
+
+	// The cache is bounded
+	client.GetGateway("00-02")
+	client.GetGateway("00-03")
+	stats := client.CacheStats()
+	if stats.Entries != 2 || stats.Evictions != 1 || stats.Hits != 1 || stats.Misses != 5 {
+		t.Fatalf("Unexpected cache stats: %+v", stats)
+	}
+}
@@ -18,10 +18,14 @@ package gocongress
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
+	"sync/atomic"
 )
 
 const (
@@ -29,140 +33,394 @@ const (
 	DefaultAddr = "https://api.lora.telenor.io"
 
 	tokenHeader = "X-API-Token"
+
+	// The most of a response body that is drained before it's closed. Up to
+	// 64 KB is read so the connection can be reused. Anything larger is left
+	// unread, and the connection is closed rather than reused.
+	maxDrain = 64 << 10
 )
 
 // CongressClient is the client interface you use to interact with Congress.
 type CongressClient struct {
-	Addr   string
-	Token  string
-	client http.Client
+	Addr string
+	// Token is the API token. It is only used if the client has no
+	// TokenSource and must not be changed while the client is in use. Use
+	// SetTokenSource to change the token of a client that is in use.
+	Token     string
+	tokens    atomic.Pointer[tokenHolder]
+	client    http.Client
+	userAgent string
+	headers   http.Header
+	retry     RetryPolicy
+	limiter   *RateLimiter
+	chain     []Middleware
+	logger    *slog.Logger
+	metrics   MetricsObserver
+	reconnect RetryPolicy
+	wsStream  bool
+	tracing   Middleware
+	journal   *Journal
+	revisions bool
+	cache     *responseCache
+	breaker   *circuitBreaker
+	plan      *Plan
+	recorder  *Recorder
+	pageSize  int
 }
 
-// NewCongressClient creates a new CongressClient.
-func NewCongressClient(token string) (*CongressClient, error) {
-	return NewCongressClientWithAddr(DefaultAddr, token)
+// ServerInfo is the information returned by the root resource of the
+// Congress server.
+type ServerInfo struct {
+	// Addr is the address of the server
+	Addr string
+	// Attributes holds the attributes of the root resource
+	Attributes map[string]interface{}
 }
 
-// NewCongressClientWithAddr creates a new CongressClient that talks to the supplied address.
-// It is only useful for internal testing; all clients should use NewCongressClient.
-func NewCongressClientWithAddr(addr, token string) (*CongressClient, error) {
+// NewCongressClient creates a new CongressClient. The client pings the server
+// when it is created unless the WithoutPing option is used.
+func NewCongressClient(token string, options ...Option) (*CongressClient, error) {
 	c := &CongressClient{
-		Addr:  addr,
-		Token: token,
+		Addr:    DefaultAddr,
+		Token:   token,
+		headers: make(http.Header),
+	}
+	cfg := clientConfig{ping: true}
+	for _, opt := range options {
+		opt(c, &cfg)
+	}
+	if cfg.timeout > 0 {
+		c.client.Timeout = cfg.timeout
+	}
+	if !cfg.ping {
+		return c, nil
 	}
 	return c, c.Ping()
 }
 
+// NewCongressClientWithAddr creates a new CongressClient that talks to the supplied address.
+// It is only useful for internal testing; all clients should use NewCongressClient.
+func NewCongressClientWithAddr(addr, token string) (*CongressClient, error) {
+	return NewCongressClient(token, WithAddr(addr))
+}
+
 // Create a new (default) request; set the content type and encode the entity
 // into the request body if it is set.
-func (c *CongressClient) newRequest(path string, entity interface{}) (*http.Request, error) {
+func (c *CongressClient) newRequest(ctx context.Context, path string, entity interface{}) (*http.Request, error) {
 	body := bytes.NewBufferString("")
 	if entity != nil {
 		if err := json.NewEncoder(body).Encode(entity); err != nil {
 			return nil, err
 		}
 	}
-	req, err := http.NewRequest(http.MethodGet, c.Addr+path, body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Addr+path, body)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set(tokenHeader, c.Token)
+	if err := c.setHeaders(ctx, req.Header); err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
 	return req, nil
 }
 
+// Set the default headers, the user agent and the API token on a request
+func (c *CongressClient) setHeaders(ctx context.Context, header http.Header) error {
+	for name, values := range c.headers {
+		header[name] = append([]string(nil), values...)
+	}
+	if c.userAgent != "" {
+		header.Set("User-Agent", c.userAgent)
+	}
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	header.Set(tokenHeader, token)
+	return nil
+}
+
 // Ping performs a simple request to the root resource of the Congress server.
 func (c *CongressClient) Ping() error {
-	_, err := c.genericGet("/", nil)
+	return c.PingContext(context.Background())
+}
+
+// PingContext performs a simple request to the root resource of the Congress
+// server using the provided context.
+func (c *CongressClient) PingContext(ctx context.Context) error {
+	_, err := genericGet[struct{}](ctx, c, "CongressClient.Ping", "/", nil)
 	return err
 }
 
-// Perform a generic GET request
-func (c *CongressClient) genericGet(path string, entity interface{}) (interface{}, error) {
-	req, err := c.newRequest(path, nil)
-	if err != nil {
+// ServerInfo retrieves the root resource of the Congress server.
+func (c *CongressClient) ServerInfo() (*ServerInfo, error) {
+	return c.ServerInfoContext(context.Background())
+}
+
+// ServerInfoContext retrieves the root resource of the Congress server using
+// the provided context.
+func (c *CongressClient) ServerInfoContext(ctx context.Context) (*ServerInfo, error) {
+	attrs := make(map[string]interface{})
+	if _, err := genericGet(ctx, c, "CongressClient.ServerInfo", "/", &attrs); err != nil {
 		return nil, err
 	}
-	return c.doRequest(req, entity)
+	return &ServerInfo{Addr: c.Addr, Attributes: attrs}, nil
 }
 
-// Perform request, check errors and decode JSON response
-func (c *CongressClient) doRequest(req *http.Request, entity interface{}) (interface{}, error) {
-	resp, err := c.client.Do(req)
+// Perform a generic GET request and decode the response into the entity.
+// The entity is returned if it was decoded, even if there's an error.
+func genericGet[T any](ctx context.Context, c *CongressClient, op string, path string, entity *T) (*T, error) {
+	req, err := c.newRequest(ctx, path, nil)
 	if err != nil {
 		return nil, err
 	}
-	if err := responseToError(resp); err != nil {
+	return doEntityRequest(c, op, req, entity)
+}
+
+// Perform the request and return the entity if it was decoded
+func doEntityRequest[T any](c *CongressClient, op string, req *http.Request, entity *T) (*T, error) {
+	var result interface{}
+	if entity != nil {
+		result = entity
+	}
+	decoded, err := c.doRequest(op, req, result)
+	if !decoded {
 		return nil, err
 	}
-	if entity != nil {
-		if err := json.NewDecoder(resp.Body).Decode(entity); err != nil {
+	return entity, err
+}
+
+// Send the request for the call. If Congress rejects the API token the token
+// is refreshed and the request is sent once more with the new token.
+func (c *CongressClient) do(call *Call) (*http.Response, error) {
+	resp, err := c.sendWithRetry(call)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || call.Request.GetBody == nil {
+		return resp, err
+	}
+	ctx := call.Request.Context()
+	token, ok := c.refreshToken(ctx, call.Request.Header.Get(tokenHeader))
+	if !ok {
+		return resp, nil
+	}
+	closeBody(resp)
+
+	req := call.Request.Clone(ctx)
+	if req.Body, err = call.Request.GetBody(); err != nil {
+		return nil, err
+	}
+	req.Header.Set(tokenHeader, token)
+	call.Request = req
+	return c.sendWithRetry(call)
+}
+
+// Send the request for the call, retrying it according to the retry policy
+func (c *CongressClient) sendWithRetry(call *Call) (*http.Response, error) {
+	req := call.Request
+	if !c.retry.retryable(req) {
+		call.Attempts++
+		return c.send(req)
+	}
+	for attempt := 0; ; attempt++ {
+		call.Attempts++
+		r := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+		resp, err := c.send(r)
+		delay, retry := c.retry.shouldRetry(r, resp, err, attempt)
+		if !retry {
+			return resp, err
+		}
+		if resp != nil {
+			closeBody(resp)
+		}
+		if err := sleepContext(req.Context(), delay); err != nil {
 			return nil, err
 		}
 	}
-	return entity, nil
 }
 
-// Do a generic PUT or POST request with JSON in request and response body
-func (c *CongressClient) genericMutation(method string, path string, entity interface{}) (interface{}, error) {
-	req, err := c.newRequest(path, entity)
+// Send a single request, waiting for the rate limiter if there is one and
+// checking the circuit breaker
+func (c *CongressClient) send(req *http.Request) (*http.Response, error) {
+	if c.limiter != nil {
+		class := limitClassFor(req)
+		waited, err := c.limiter.wait(req.Context(), class)
+		c.limiterWaited(class, waited)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := c.breaker.allow(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	c.breaker.record(req.Context(), resp, err)
+	return resp, err
+}
+
+// Perform request through the middleware chain. The returned flag is set if
+// the response was decoded into the entity.
+func (c *CongressClient) doRequest(op string, req *http.Request, entity interface{}) (bool, error) {
+	call := &Call{Operation: op, Request: req, Result: entity}
+	err := c.invoke(call, c.roundTrip)
+	return call.decoded, err
+}
+
+// Drain and close the response body so the connection can be reused
+func closeBody(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrain))
+	resp.Body.Close()
+}
+
+// Perform request, check errors and decode JSON response. This is the last
+// handler in the middleware chain.
+func (c *CongressClient) roundTrip(call *Call) error {
+	if call.Request.Method != http.MethodGet {
+		if c.plan != nil {
+			return c.plan.record(call)
+		}
+		defer c.cache.invalidate(call.Request.URL.Path)
+	}
+	if entry, ok := c.cache.lookup(call); ok {
+		return c.decode(call, bytes.NewReader(entry.body), entry.etag)
+	}
+	resp, err := c.do(call)
+	if err != nil {
+		return wrapError(call, err)
+	}
+	defer closeBody(resp)
+	call.Response = resp
+	if err := responseToError(call, resp); err != nil {
+		return err
+	}
+	if call.Result == nil {
+		return nil
+	}
+	if !c.cache.cacheable(call) {
+		return c.decode(call, resp.Body, resp.Header.Get("ETag"))
+	}
+	buf := &bytes.Buffer{}
+	if err := c.decode(call, io.TeeReader(resp.Body, buf), resp.Header.Get("ETag")); err != nil {
+		return err
+	}
+	c.cache.store(call, buf.Bytes(), resp.Header.Get("ETag"))
+	return nil
+}
+
+// Decode the response body into the result of the call
+func (c *CongressClient) decode(call *Call, body io.Reader, etag string) error {
+	if call.Result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(body).Decode(call.Result); err != nil {
+		return wrapError(call, err)
+	}
+	call.decoded = true
+	c.trackRevision(call.Result, etag)
+	return nil
+}
+
+// Do a generic PUT or POST request with JSON in request and response body.
+// The response is decoded into the entity that is sent. The entity is
+// returned if the response was decoded, even if there's an error.
+func genericMutation[T any](ctx context.Context, c *CongressClient, op string, method string, path string, entity *T) (*T, error) {
+	req, err := c.newRequest(ctx, path, entity)
 	if err != nil {
 		return nil, err
 	}
 	req.Method = method
-	return c.doRequest(req, entity)
+	if method != http.MethodPut {
+		return doEntityRequest(c, op, req, entity)
+	}
+	if err := checkUnchanged(ctx, c, op, req, entity); err != nil {
+		return nil, err
+	}
+	ret, err := doEntityRequest(c, op, req, entity)
+	if err != nil && c.revisions {
+		return ret, conflictError(op, path, err)
+	}
+	return ret, err
 }
 
 // Do a generic DELETE - ie no content in request or response body.
-func (c *CongressClient) genericDelete(path string) error {
-	req, err := c.newRequest(path, nil)
+func (c *CongressClient) genericDelete(ctx context.Context, op string, path string) error {
+	req, err := c.newRequest(ctx, path, nil)
 	if err != nil {
 		return err
 	}
 	req.Method = http.MethodDelete
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return err
-	}
-	return responseToError(resp)
+	_, err = c.doRequest(op, req, nil)
+	return err
 }
 
 // NewApplication creates a new application.
 func (c *CongressClient) NewApplication() (*Application, error) {
-	app := &Application{"", newTags(), c}
-	ret, err := c.genericMutation(http.MethodPost, "/applications", app)
+	return c.NewApplicationContext(context.Background())
+}
+
+// NewApplicationContext creates a new application using the provided context.
+func (c *CongressClient) NewApplicationContext(ctx context.Context) (*Application, error) {
+	app := &Application{"", newTags(), c, entityRevision{}}
+	ret, err := genericMutation(ctx, c, "CongressClient.NewApplication", http.MethodPost, "/applications", app)
 	if err != nil {
 		return nil, err
 	}
-	return ret.(*Application), nil
+	return ret, nil
 }
 
 // Applications return the list of your applications in Congress.
 func (c *CongressClient) Applications() ([]Application, error) {
+	return c.ApplicationsContext(context.Background())
+}
+
+// ApplicationsContext return the list of your applications in Congress using
+// the provided context.
+func (c *CongressClient) ApplicationsContext(ctx context.Context) ([]Application, error) {
 	type appList struct {
 		Apps []Application `json:"applications"`
 	}
 
-	list, err := c.genericGet("/applications", &appList{})
+	list, err := genericGet(ctx, c, "CongressClient.Applications", "/applications", &appList{})
 	if err != nil {
 		return nil, err
 	}
-	return list.(*appList).Apps, nil
+	apps := list.Apps
+	for i := range apps {
+		apps[i].client = c
+		c.trackRevision(&apps[i], "")
+	}
+	return apps, nil
 }
 
 // GetApplication retrieves an application from Congress.
 func (c *CongressClient) GetApplication(eui string) (*Application, error) {
-	app := &Application{"", newTags(), c}
-	existingApp, err := c.genericGet(fmt.Sprintf("/applications/%s", eui), app)
+	return c.GetApplicationContext(context.Background(), eui)
+}
+
+// GetApplicationContext retrieves an application from Congress using the
+// provided context.
+func (c *CongressClient) GetApplicationContext(ctx context.Context, eui string) (*Application, error) {
+	app := &Application{"", newTags(), c, entityRevision{}}
+	existingApp, err := genericGet(ctx, c, "CongressClient.GetApplication", fmt.Sprintf("/applications/%s", eui), app)
 	if err != nil {
 		return nil, err
 	}
-	return existingApp.(*Application), nil
+	return existingApp, nil
 }
 
 // NewGateway creates a new gateway in Congress.
 func (c *CongressClient) NewGateway(eui string, ip net.IP, strict bool, position *Position) (*Gateway, error) {
-	gw := &Gateway{"", "", true, 0, 0, 0, newTags(), c}
+	return c.NewGatewayContext(context.Background(), eui, ip, strict, position)
+}
+
+// NewGatewayContext creates a new gateway in Congress using the provided context.
+func (c *CongressClient) NewGatewayContext(ctx context.Context, eui string, ip net.IP, strict bool, position *Position) (*Gateway, error) {
+	gw := &Gateway{"", "", true, 0, 0, 0, newTags(), c, entityRevision{}}
 	gw.EUI = eui
 	gw.IP = ip.String()
 	gw.StrictIP = strict
@@ -171,19 +429,45 @@ func (c *CongressClient) NewGateway(eui string, ip net.IP, strict bool, position
 		gw.Latitude = position.Latitude
 		gw.Longitude = position.Longitude
 	}
-	ret, err := c.genericMutation(http.MethodPost, "/gateways", gw)
+	ret, err := genericMutation(ctx, c, "CongressClient.NewGateway", http.MethodPost, "/gateways", gw)
 	if err != nil {
 		return nil, err
 	}
-	return ret.(*Gateway), nil
+	return ret, nil
 }
 
 // Gateways return the list of your gateways in Congress.
 func (c *CongressClient) Gateways() ([]Gateway, error) {
-	list, err := c.genericGet("/gateways", &gwList{})
+	return c.GatewaysContext(context.Background())
+}
+
+// GatewaysContext return the list of your gateways in Congress using the
+// provided context.
+func (c *CongressClient) GatewaysContext(ctx context.Context) ([]Gateway, error) {
+	list, err := genericGet(ctx, c, "CongressClient.Gateways", "/gateways", &gwList{})
 	if err != nil {
 		return nil, err
 	}
-	return list.(*gwList).Gws, nil
+	gws := list.Gws
+	for i := range gws {
+		gws[i].client = c
+		c.trackRevision(&gws[i], "")
+	}
+	return gws, nil
+}
+
+// GetGateway retrieves a gateway from Congress.
+func (c *CongressClient) GetGateway(eui string) (*Gateway, error) {
+	return c.GetGatewayContext(context.Background(), eui)
+}
 
+// GetGatewayContext retrieves a gateway from Congress using the provided
+// context.
+func (c *CongressClient) GetGatewayContext(ctx context.Context, eui string) (*Gateway, error) {
+	gw := &Gateway{tagResource: newTags(), client: c}
+	ret, err := genericGet(ctx, c, "CongressClient.GetGateway", fmt.Sprintf("/gateways/%s", eui), gw)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
 }
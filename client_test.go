@@ -17,10 +17,19 @@ package gocongress
  */
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/gregersrygg/gocongress/congresstest"
 )
 
 var (
@@ -28,15 +37,16 @@ var (
 	token = flag.String("api-token", "", "congress API token")
 )
 
+// The tests run against an in-memory server unless a token is set. Run
+// `go test -args -api-token <your-api-token>` to test against Congress.
 func TestMain(m *testing.M) {
 	flag.Parse()
 	if *token == "" {
-		if _, err := NewCongressClientWithAddr(*addr, ""); err != nil {
-			fmt.Println("Error creating client:", err)
-			fmt.Println("You might need to set the token flag when running the tests against the address", *addr)
-			fmt.Println("That is, run `go test -args -token <your-api-token>.")
-			os.Exit(1)
-		}
+		server := congresstest.NewServer("")
+		*addr = server.URL
+		code := m.Run()
+		server.Close()
+		os.Exit(code)
 	}
 
 	os.Exit(m.Run())
@@ -53,3 +63,81 @@ func TestPing(t *testing.T) {
 		t.Fatalf("Got error calling ping(): %v", err)
 	}
 }
+
+func TestPingContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := &CongressClient{Addr: server.URL}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := client.PingContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded but got %v", err)
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gateways/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"not found"}`))
+			return
+		}
+		// Trailing data after the JSON document must be drained too
+		w.Write([]byte(`{"gatewayEUI":"00-01"}` + "\n\n"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing())
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := client.GetGateway("00-01"); err != nil {
+			t.Fatalf("Got error retrieving gateway: %v", err)
+		}
+		if _, err := client.GetGateway("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Expected not found but got %v", err)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Fatalf("Expected one connection but %d were opened", n)
+	}
+}
+
+func TestUpdateDecodedWithError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"gatewayEUI":"00-01","tags":{"name":"updated"}}`))
+	}))
+	defer server.Close()
+
+	failAfter := func(next Handler) Handler {
+		return func(call *Call) error {
+			if err := next(call); err != nil {
+				return err
+			}
+			return fmt.Errorf("rejected by middleware")
+		}
+	}
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithMiddleware(failAfter))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	gw := &Gateway{EUI: "00-01", tagResource: newTags(), client: client}
+	updated, err := gw.Update()
+	if err == nil || updated == nil || updated.GetTag("name") != "updated" {
+		t.Fatalf("Expected decoded gateway and error but got %v (%v)", updated, err)
+	}
+}
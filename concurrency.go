@@ -0,0 +1,191 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+)
+
+// WithOptimisticUpdates makes Update on applications, devices, gateways and
+// outputs fail with a ConflictError if the entity has changed in Congress
+// since it was read. If Congress returned an ETag for the entity the check is
+// done by Congress with an If-Match header. Otherwise the client retrieves
+// the entity before updating it and compares it with the version that was
+// read; there is a small window between the check and the update where
+// changes go undetected. Outputs are compared with the matching entry in the
+// application's output list, ignoring the logs and status. Entities that
+// weren't read from Congress are updated unconditionally.
+func WithOptimisticUpdates() Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.revisions = true
+	}
+}
+
+// ConflictError is returned when an entity has been changed by someone else
+// since it was read. It matches ErrConflict.
+type ConflictError struct {
+	Operation string
+	Path      string
+	// Err is the error from Congress if Congress detected the conflict
+	Err error
+}
+
+func (c *ConflictError) Error() string {
+	return fmt.Sprintf("%s %s: entity has changed since it was read", c.Operation, c.Path)
+}
+
+// Unwrap returns the error from Congress
+func (c *ConflictError) Unwrap() error {
+	return c.Err
+}
+
+// Is matches ErrConflict
+func (c *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// RetryOnConflict calls mutate until it returns an error that isn't a
+// conflict, or until it has been called the specified number of times. The
+// mutate function should read the entity, apply its changes and update it.
+func RetryOnConflict(ctx context.Context, attempts int, mutate func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(ctx, DefaultRetryPolicy.backoff(attempt-1)); err != nil {
+				return err
+			}
+		}
+		if err = mutate(ctx); !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// The revision of an entity as it was read from Congress
+type entityRevision struct {
+	etag     string
+	snapshot []byte
+}
+
+// Implemented by entities that keep track of their revision
+type revisioned interface {
+	revision() *entityRevision
+}
+
+func (app *Application) revision() *entityRevision  { return &app.rev }
+func (output *AppOutput) revision() *entityRevision { return &output.rev }
+func (device *Device) revision() *entityRevision    { return &device.rev }
+func (gw *Gateway) revision() *entityRevision       { return &gw.rev }
+
+// Record the revision of an entity that has been read
+func (c *CongressClient) trackRevision(entity interface{}, etag string) {
+	if !c.revisions {
+		return
+	}
+	if r, ok := entity.(revisioned); ok {
+		snapshot, _ := revisionSnapshot(entity)
+		*r.revision() = entityRevision{etag: etag, snapshot: snapshot}
+	}
+}
+
+// Encode the fields of the entity that are compared by the update check.
+// The logs and status of outputs change without anyone updating them.
+func revisionSnapshot(entity interface{}) ([]byte, error) {
+	if output, ok := entity.(*AppOutput); ok {
+		stripped := *output
+		stripped.Log = nil
+		stripped.Status = ""
+		entity = &stripped
+	}
+	return json.Marshal(entity)
+}
+
+// Check that the entity is unchanged in Congress before it is updated. If
+// there's an ETag the If-Match header is set on the request and Congress
+// does the check.
+func checkUnchanged[T any](ctx context.Context, c *CongressClient, op string, req *http.Request, entity *T) error {
+	r, ok := any(entity).(revisioned)
+	if !c.revisions || !ok {
+		return nil
+	}
+	rev := r.revision()
+	if rev.etag != "" {
+		req.Header.Set("If-Match", rev.etag)
+		return nil
+	}
+	if rev.snapshot == nil {
+		return nil
+	}
+	// The check must see the current entity, not a cached copy of the
+	// one that was read
+	var current interface{}
+	if _, ok := r.(*AppOutput); ok {
+		// Congress has no resource for a single output
+		output, err := c.currentOutput(NoCache(ctx), op+"Check", req.URL.Path)
+		if err != nil {
+			return err
+		}
+		current = output
+	} else {
+		entity, err := genericGet(NoCache(ctx), c, op+"Check", req.URL.Path, new(T))
+		if err != nil {
+			return err
+		}
+		current = entity
+	}
+	buf, err := revisionSnapshot(current)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(buf, rev.snapshot) {
+		return &ConflictError{Operation: op, Path: req.URL.Path}
+	}
+	return nil
+}
+
+// Retrieve an output from the application's output list
+func (c *CongressClient) currentOutput(ctx context.Context, op, outputPath string) (*AppOutput, error) {
+	type outputList struct {
+		Outputs []AppOutput `json:"outputs"`
+	}
+	list, err := genericGet(ctx, c, op, path.Dir(outputPath), &outputList{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Outputs {
+		if list.Outputs[i].EUI == path.Base(outputPath) {
+			return &list.Outputs[i], nil
+		}
+	}
+	return nil, &CongressError{Message: http.StatusText(http.StatusNotFound), StatusCode: http.StatusNotFound, Operation: op, Path: outputPath}
+}
+
+// Convert errors from Congress to conflict errors when Congress detected
+// a conflict
+func conflictError(op string, path string, err error) error {
+	if errors.Is(err, ErrConflict) {
+		return &ConflictError{Operation: op, Path: path, Err: err}
+	}
+	return err
+}
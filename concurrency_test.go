@@ -0,0 +1,201 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gregersrygg/gocongress/congresstest"
+)
+
+// A single gateway resource. ETags are only used if useETag is set.
+type gatewayServer struct {
+	mutex   sync.Mutex
+	body    string
+	version int
+	useETag bool
+}
+
+func (s *gatewayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	etag := fmt.Sprintf(`"%d"`, s.version)
+	if r.Method == http.MethodPut {
+		if match := r.Header.Get("If-Match"); s.useETag && match != etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		buf, _ := io.ReadAll(r.Body)
+		s.body = string(buf)
+		s.version++
+		etag = fmt.Sprintf(`"%d"`, s.version)
+	}
+	if s.useETag {
+		w.Header().Set("ETag", etag)
+	}
+	w.Write([]byte(s.body))
+}
+
+func TestOptimisticUpdates(t *testing.T) {
+	for _, useETag := range []bool{false, true} {
+		state := &gatewayServer{body: `{"gatewayEUI":"00-01"}`, useETag: useETag}
+		server := httptest.NewServer(state)
+		defer server.Close()
+
+		client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithOptimisticUpdates())
+		if err != nil {
+			t.Fatalf("Got error creating client: %v", err)
+		}
+		first, _ := client.GetGateway("00-01")
+		second, _ := client.GetGateway("00-01")
+
+		first.SetTag("owner", "first")
+		if _, err := first.Update(); err != nil {
+			t.Fatalf("Got error updating first gateway (etag=%v): %v", useETag, err)
+		}
+		second.SetTag("owner", "second")
+		_, err = second.Update()
+		var conflict *ConflictError
+		if !errors.Is(err, ErrConflict) || !errors.As(err, &conflict) {
+			t.Fatalf("Expected conflict (etag=%v) but got %v", useETag, err)
+		}
+
+		attempts := 0
+		err = RetryOnConflict(context.Background(), 3, func(ctx context.Context) error {
+			attempts++
+			gw := second
+			if attempts > 1 {
+				if gw, err = client.GetGatewayContext(ctx, "00-01"); err != nil {
+					return err
+				}
+			}
+			gw.SetTag("owner", "second")
+			_, err := gw.UpdateContext(ctx)
+			return err
+		})
+		if err != nil || attempts != 2 {
+			t.Fatalf("Expected update to succeed on second attempt (etag=%v) but got %v after %d attempts", useETag, err, attempts)
+		}
+		gw, _ := client.GetGateway("00-01")
+		if gw.GetTag("owner") != "second" {
+			t.Fatalf("Gateway wasn't updated (etag=%v): %v", useETag, gw.Tags)
+		}
+	}
+}
+
+func TestOptimisticUpdatesWithCache(t *testing.T) {
+	server := congresstest.NewServer("")
+	defer server.Close()
+	first, err := NewCongressClient("", WithAddr(server.URL), WithOptimisticUpdates(), WithCache(CacheConfig{Applications: time.Minute}))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	second, err := NewCongressClient("", WithAddr(server.URL))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	created, err := first.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+
+	app, err := first.GetApplication(created.EUI)
+	if err != nil {
+		t.Fatalf("Got error reading application: %v", err)
+	}
+	other, err := second.GetApplication(created.EUI)
+	if err != nil {
+		t.Fatalf("Got error reading application: %v", err)
+	}
+	other.SetTag("owner", "second")
+	if _, err := other.Update(); err != nil {
+		t.Fatalf("Got error updating application: %v", err)
+	}
+
+	app.SetTag("owner", "first")
+	if _, err := app.Update(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected conflict with a cached application but got %v", err)
+	}
+	if app, err = first.GetApplication(created.EUI); err != nil || app.GetTag("owner") != "second" {
+		t.Fatalf("Expected the check to refresh the cache but got %v (%v)", app.Tags, err)
+	}
+	app.SetTag("owner", "first")
+	if _, err := app.Update(); err != nil {
+		t.Fatalf("Got error updating refreshed application: %v", err)
+	}
+}
+
+func TestOptimisticOutputUpdates(t *testing.T) {
+	server := congresstest.NewServer("")
+	defer server.Close()
+	first, err := NewCongressClient("", WithAddr(server.URL), WithOptimisticUpdates())
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	second, err := NewCongressClient("", WithAddr(server.URL))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, err := first.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	output, err := app.NewOutput(&MQTTConfig{Endpoint: "localhost", Port: 1883})
+	if err != nil {
+		t.Fatalf("Got error creating output: %v", err)
+	}
+	output.Config["port"] = 8883
+	if output, err = output.Update(); err != nil {
+		t.Fatalf("Got error updating output: %v", err)
+	}
+
+	others, err := second.application(app.EUI).Outputs()
+	if err != nil || len(others) != 1 {
+		t.Fatalf("Got error listing outputs: %v (%v)", others, err)
+	}
+	others[0].Config["endpoint"] = "example.com"
+	if _, err := others[0].Update(); err != nil {
+		t.Fatalf("Got error updating output: %v", err)
+	}
+	output.Config["port"] = 1884
+	if _, err := output.Update(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected conflict for a changed output but got %v", err)
+	}
+
+	outputs, err := app.Outputs()
+	if err != nil || len(outputs) != 1 {
+		t.Fatalf("Got error listing outputs: %v (%v)", outputs, err)
+	}
+	outputs[0].Config["port"] = 1884
+	if _, err := outputs[0].Update(); err != nil {
+		t.Fatalf("Got error updating refreshed output: %v", err)
+	}
+	if err := second.DeleteApplicationOutputContext(context.Background(), app.EUI, output.EUI); err != nil {
+		t.Fatalf("Got error removing output: %v", err)
+	}
+	if _, err := outputs[0].Update(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected not found for a removed output but got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+// Package congressfake provides a fake Congress for code that uses the
+// gocongress service interfaces. The fake is a client connected to an
+// in-memory congresstest server, so the entities it returns are bound to it
+// and their Update, Delete and other methods work like they do against
+// Congress.
+package congressfake
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"github.com/gregersrygg/gocongress"
+	"github.com/gregersrygg/gocongress/congresstest"
+)
+
+var (
+	_ gocongress.ApplicationService = (*Service)(nil)
+	_ gocongress.DeviceService      = (*Service)(nil)
+	_ gocongress.GatewayService     = (*Service)(nil)
+)
+
+// Service implements the service interfaces with a client connected to a
+// congresstest server. Use the server to inspect the state, inject uplinks
+// or add faults. Close the service when done.
+type Service struct {
+	*gocongress.CongressClient
+	// Server is the server behind the client
+	Server *congresstest.Server
+}
+
+// New starts a fake Congress and returns a service connected to it. The
+// options are applied to the client after the address and the option for
+// unencrypted data streams.
+func New(opts ...gocongress.Option) (*Service, error) {
+	server := congresstest.NewServer("")
+	opts = append([]gocongress.Option{gocongress.WithAddr(server.URL), gocongress.WithInsecureStream()}, opts...)
+	client, err := gocongress.NewCongressClient("", opts...)
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	return &Service{CongressClient: client, Server: server}, nil
+}
+
+// Close shuts down the server
+func (s *Service) Close() {
+	s.Server.Close()
+}
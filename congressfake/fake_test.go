@@ -0,0 +1,79 @@
+package congressfake
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gregersrygg/gocongress"
+	"github.com/gregersrygg/gocongress/congresstest"
+)
+
+// Rename the device through the interface like code under test would
+func rename(ctx context.Context, svc gocongress.DeviceService, appEUI, eui, name string) error {
+	device, err := svc.GetApplicationDeviceContext(ctx, appEUI, eui)
+	if err != nil {
+		return err
+	}
+	device.SetTag("name", name)
+	_, err = svc.UpdateApplicationDeviceContext(ctx, appEUI, device)
+	return err
+}
+
+func TestService(t *testing.T) {
+	svc, err := New(gocongress.WithoutPing())
+	if err != nil {
+		t.Fatalf("Got error creating service: %v", err)
+	}
+	defer svc.Close()
+
+	ctx := context.Background()
+	app, err := svc.NewApplicationContext(ctx)
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	device, err := svc.NewApplicationDeviceContext(ctx, app.EUI, gocongress.OTAA)
+	if err != nil {
+		t.Fatalf("Got error creating device: %v", err)
+	}
+	if err := rename(ctx, svc, app.EUI, device.EUI, "fake"); err != nil {
+		t.Fatalf("Got error renaming device: %v", err)
+	}
+	if stored, ok := svc.Server.Device(app.EUI, device.EUI); !ok || stored.Tags["name"] != "fake" {
+		t.Fatalf("Device wasn't renamed: %+v", stored)
+	}
+
+	// The entities are bound to the service
+	device.SetTag("name", "entity")
+	if _, err := device.UpdateContext(ctx); err != nil {
+		t.Fatalf("Got error updating device: %v", err)
+	}
+	if err := svc.Server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{StringData: "01"}); err != nil {
+		t.Fatalf("Got error injecting uplink: %v", err)
+	}
+	if msgs, err := device.MessagesContext(ctx, 1); err != nil || len(msgs) != 1 || msgs[0].StringData != "01" {
+		t.Fatalf("Unexpected messages %+v (%v)", msgs, err)
+	}
+	if err := device.DeleteContext(ctx); err != nil {
+		t.Fatalf("Got error removing device: %v", err)
+	}
+	if _, err := svc.GetApplicationDeviceContext(ctx, app.EUI, device.EUI); !errors.Is(err, gocongress.ErrNotFound) {
+		t.Fatalf("Expected not found but got %v", err)
+	}
+}
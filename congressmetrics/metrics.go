@@ -0,0 +1,145 @@
+// Package congressmetrics collects metrics for gocongress clients and
+// exports them to Prometheus.
+package congressmetrics
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gregersrygg/gocongress"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics collects metrics for API calls and data streams. It implements
+// prometheus.Collector and can be registered with a Prometheus registry.
+// Use it with gocongress.WithMetrics. A single Metrics instance can be
+// shared by several clients.
+type Metrics struct {
+	requests       *prometheus.CounterVec
+	latency        *prometheus.HistogramVec
+	retries        *prometheus.CounterVec
+	limiterWaits   *prometheus.CounterVec
+	limiterWaitSec *prometheus.CounterVec
+	received       prometheus.Counter
+	dropped        prometheus.Counter
+	reconnects     prometheus.Counter
+	decodeErrors   prometheus.Counter
+}
+
+// New creates a new metrics collector. The metric names are prefixed with
+// "congress_".
+func New() *Metrics {
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "congress_requests_total",
+			Help: "Number of API calls by operation and status code.",
+		}, []string{"operation", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "congress_request_duration_seconds",
+			Help:    "Duration of API calls, including retries.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "congress_request_retries_total",
+			Help: "Number of retried requests by operation.",
+		}, []string{"operation"}),
+		limiterWaits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "congress_ratelimit_waits_total",
+			Help: "Number of requests that waited for the rate limiter.",
+		}, []string{"class"}),
+		limiterWaitSec: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "congress_ratelimit_wait_seconds_total",
+			Help: "Time spent waiting for the rate limiter.",
+		}, []string{"class"}),
+		received: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "congress_stream_messages_received_total",
+			Help: "Number of device data messages received on data streams.",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "congress_stream_messages_dropped_total",
+			Help: "Number of device data messages dropped because the receiver was too slow.",
+		}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "congress_stream_reconnects_total",
+			Help: "Number of times a data stream has reconnected.",
+		}),
+		decodeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "congress_stream_decode_errors_total",
+			Help: "Number of data stream frames that couldn't be decoded.",
+		}),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.requests, m.latency, m.retries, m.limiterWaits, m.limiterWaitSec,
+		m.received, m.dropped, m.reconnects, m.decodeErrors,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// ObserveCall implements gocongress.MetricsObserver
+func (m *Metrics) ObserveCall(call *gocongress.Call, err error, duration time.Duration) {
+	m.latency.WithLabelValues(call.Operation).Observe(duration.Seconds())
+
+	code := "ok"
+	switch {
+	case call.Response != nil:
+		code = strconv.Itoa(call.Response.StatusCode)
+	case err != nil:
+		code = "error"
+	}
+	m.requests.WithLabelValues(call.Operation, code).Inc()
+	if call.Attempts > 1 {
+		m.retries.WithLabelValues(call.Operation).Add(float64(call.Attempts - 1))
+	}
+}
+
+// ObserveLimiterWait implements gocongress.MetricsObserver
+func (m *Metrics) ObserveLimiterWait(class gocongress.LimitClass, waited time.Duration) {
+	m.limiterWaits.WithLabelValues(class.String()).Inc()
+	m.limiterWaitSec.WithLabelValues(class.String()).Add(waited.Seconds())
+}
+
+// ObserveStream implements gocongress.MetricsObserver
+func (m *Metrics) ObserveStream(event gocongress.StreamEvent) {
+	switch event {
+	case gocongress.StreamReceived:
+		m.received.Inc()
+	case gocongress.StreamDropped:
+		m.dropped.Inc()
+	case gocongress.StreamReconnected:
+		m.reconnects.Inc()
+	case gocongress.StreamDecodeError:
+		m.decodeErrors.Inc()
+	}
+}
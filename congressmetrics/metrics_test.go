@@ -0,0 +1,135 @@
+package congressmetrics
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gregersrygg/gocongress"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/net/websocket"
+)
+
+func TestMetrics(t *testing.T) {
+	// The first stream has a message that can't be decoded and the second
+	// has a message that the receiver doesn't read. Later streams are idle.
+	var streams atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gateways", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"gateways":[]}`))
+	})
+	mux.HandleFunc("/applications/00-00", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"applicationEUI":"00-00"}`))
+	})
+	mux.Handle("/applications/00-00/stream", websocket.Handler(func(ws *websocket.Conn) {
+		switch streams.Add(1) {
+		case 1:
+			websocket.Message.Send(ws, `{"type":"DeviceData","data":{"deviceEUI":"00-01"}}`)
+			websocket.Message.Send(ws, `not json`)
+		case 2:
+			websocket.Message.Send(ws, `{"type":"DeviceData","data":{"deviceEUI":"00-02"}}`)
+		}
+		// Keep the socket open until the client closes it
+		var buf []byte
+		websocket.Message.Receive(ws, &buf)
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	metrics := New()
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(metrics); err != nil {
+		t.Fatalf("Couldn't register metrics: %v", err)
+	}
+
+	client, err := gocongress.NewCongressClient("", gocongress.WithAddr(server.URL), gocongress.WithoutPing(),
+		gocongress.WithInsecureStream(), gocongress.WithMetrics(metrics),
+		gocongress.WithStreamReconnect(gocongress.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	if _, err := client.Gateways(); err != nil {
+		t.Fatalf("Got error retrieving gateways: %v", err)
+	}
+	if n := testutil.ToFloat64(metrics.requests.WithLabelValues("CongressClient.Gateways", "200")); n != 1 {
+		t.Fatalf("Expected 1 request but got %v", n)
+	}
+
+	// The second request waits for the rate limiter
+	limited, err := gocongress.NewCongressClient("", gocongress.WithAddr(server.URL), gocongress.WithoutPing(), gocongress.WithMetrics(metrics),
+		gocongress.WithRateLimiter(gocongress.NewRateLimiter(gocongress.RateLimits{Read: gocongress.RateLimit{Rate: 100, Burst: 1}})))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := limited.Gateways(); err != nil {
+			t.Fatalf("Got error retrieving gateways: %v", err)
+		}
+	}
+	if n := testutil.ToFloat64(metrics.limiterWaits.WithLabelValues("read")); n != 1 {
+		t.Fatalf("Expected 1 rate limiter wait but got %v", n)
+	}
+
+	app, err := client.GetApplication("00-00")
+	if err != nil {
+		t.Fatalf("Got error retrieving application: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, errs, err := app.DataStreamContext(ctx)
+	if err != nil {
+		t.Fatalf("Couldn't open data stream: %v", err)
+	}
+	nextError := func() {
+		select {
+		case <-errs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected error on the stream")
+		}
+	}
+	if msg := <-ch; msg.DeviceEUI != "00-01" {
+		t.Fatalf("Unexpected message: %+v", msg)
+	}
+	// The decode error ends the first stream, and the unread message ends
+	// the second
+	nextError()
+	nextError()
+
+	if n := testutil.ToFloat64(metrics.decodeErrors); n != 1 {
+		t.Fatalf("Expected 1 decode error but got %v", n)
+	}
+	if n := testutil.ToFloat64(metrics.dropped); n != 1 {
+		t.Fatalf("Expected 1 dropped message but got %v", n)
+	}
+	if n := testutil.ToFloat64(metrics.received); n != 2 {
+		t.Fatalf("Expected 2 received messages but got %v", n)
+	}
+	// The error is reported before the stream reconnects
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(metrics.reconnects) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := testutil.ToFloat64(metrics.reconnects); n != 2 {
+		t.Fatalf("Expected 2 reconnects but got %v", n)
+	}
+}
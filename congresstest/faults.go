@@ -0,0 +1,230 @@
+package congresstest
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The number of bytes written at a time for slow bodies
+const slowChunk = 16
+
+// Fault makes the server misbehave for matching requests. Faults are
+// checked in the order they are added and the first match is used.
+type Fault struct {
+	// Method is the HTTP method to match. Empty matches every method.
+	Method string
+	// Path is matched with path.Match, e.g. "/applications/*/devices".
+	// Empty matches every path.
+	Path string
+	// Count is the number of requests the fault applies to. Zero applies it
+	// until it's removed.
+	Count int
+	// Latency delays the response.
+	Latency time.Duration
+	// StatusCode makes the server respond with an error instead of handling
+	// the request.
+	StatusCode int
+	// RetryAfter sets the Retry-After header, rounded up to whole seconds.
+	// The status code defaults to 429 Too Many Requests.
+	RetryAfter time.Duration
+	// MalformedJSON truncates the response body. The request is still
+	// handled.
+	MalformedJSON bool
+	// SlowBody is the delay between each small chunk of the response body.
+	SlowBody time.Duration
+}
+
+// A fault and the number of requests left for it
+type faultState struct {
+	Fault
+	remaining int
+}
+
+// AddFault adds a fault to the server. Call the returned function to remove
+// it. MalformedJSON and SlowBody are ignored for data streams.
+func (s *Server) AddFault(fault Fault) func() {
+	state := &faultState{Fault: fault, remaining: fault.Count}
+	s.mutex.Lock()
+	s.faults = append(s.faults, state)
+	s.mutex.Unlock()
+	return func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.removeFault(state)
+	}
+}
+
+// ClearFaults removes all faults
+func (s *Server) ClearFaults() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = nil
+}
+
+// DropStreams closes the web sockets for the application's data streams
+// and returns the number of connections that were closed.
+func (s *Server) DropStreams(appEUI string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[appEUI]
+	if !ok {
+		return 0
+	}
+	dropped := len(app.streams)
+	for sub := range app.streams {
+		sub.close()
+		delete(app.streams, sub)
+	}
+	return dropped
+}
+
+// SendStreamFrame sends a raw frame on the application's data streams. The
+// frame doesn't have to be valid JSON.
+func (s *Server) SendStreamFrame(appEUI string, frame string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[appEUI]
+	if !ok {
+		return fmt.Errorf("application %s: %w", appEUI, ErrNotFound)
+	}
+	s.broadcast(app, []byte(frame))
+	return nil
+}
+
+// SendStreamError sends an "Error" frame on the application's data streams
+func (s *Server) SendStreamError(appEUI string, message string) error {
+	frame, err := json.Marshal(map[string]interface{}{"type": "Error", "message": message})
+	if err != nil {
+		return err
+	}
+	return s.SendStreamFrame(appEUI, string(frame))
+}
+
+// Find the fault for the request
+func (s *Server) fault(r *http.Request) (Fault, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, state := range s.faults {
+		if state.Method != "" && state.Method != r.Method {
+			continue
+		}
+		if state.Path != "" {
+			if ok, _ := path.Match(state.Path, r.URL.Path); !ok {
+				continue
+			}
+		}
+		if state.Count > 0 {
+			if state.remaining--; state.remaining == 0 {
+				s.removeFault(state)
+			}
+		}
+		return state.Fault, true
+	}
+	return Fault{}, false
+}
+
+// Must be called with the mutex held
+func (s *Server) removeFault(state *faultState) {
+	for i, f := range s.faults {
+		if f == state {
+			s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			return
+		}
+	}
+}
+
+// Apply faults before passing on the request
+func (s *Server) injectFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fault, ok := s.fault(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if fault.Latency > 0 {
+			select {
+			case <-time.After(fault.Latency):
+			case <-r.Context().Done():
+				return
+			case <-s.done:
+				return
+			}
+		}
+
+		status := fault.StatusCode
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(fault.RetryAfter.Seconds()))))
+			if status == 0 {
+				status = http.StatusTooManyRequests
+			}
+		}
+		if status != 0 {
+			writeError(w, status, http.StatusText(status))
+			return
+		}
+
+		websocket := strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+		if websocket || (!fault.MalformedJSON && fault.SlowBody == 0) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, r)
+		body := rec.Body.Bytes()
+		if fault.MalformedJSON {
+			body = body[:len(body)/2]
+			if len(body) == 0 {
+				body = []byte("{")
+			}
+		}
+		for key, values := range rec.Header() {
+			w.Header()[key] = values
+		}
+		w.Header().Del("Content-Length")
+		w.WriteHeader(rec.Code)
+		for len(body) > 0 {
+			n := min(slowChunk, len(body))
+			if _, err := w.Write(body[:n]); err != nil {
+				return
+			}
+			body = body[n:]
+			if fault.SlowBody == 0 || len(body) == 0 {
+				continue
+			}
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+			select {
+			case <-time.After(fault.SlowBody):
+			case <-r.Context().Done():
+				return
+			case <-s.done:
+				return
+			}
+		}
+	})
+}
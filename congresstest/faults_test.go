@@ -0,0 +1,145 @@
+package congresstest_test
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gregersrygg/gocongress"
+	"github.com/gregersrygg/gocongress/congresstest"
+)
+
+func TestFaults(t *testing.T) {
+	server := congresstest.NewServer("")
+	defer server.Close()
+
+	policy := gocongress.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+	client, err := gocongress.NewCongressClient("", gocongress.WithAddr(server.URL), gocongress.WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+
+	server.AddFault(congresstest.Fault{Path: "/applications", StatusCode: http.StatusServiceUnavailable, Count: 2})
+	if _, err := client.Applications(); err != nil {
+		t.Fatalf("Expected retries to succeed but got %v", err)
+	}
+	remove := server.AddFault(congresstest.Fault{Path: "/applications", StatusCode: http.StatusServiceUnavailable})
+	if _, err := client.Applications(); !errors.Is(err, gocongress.ErrServer) {
+		t.Fatalf("Expected server error but got %v", err)
+	}
+	remove()
+
+	server.AddFault(congresstest.Fault{Method: http.MethodGet, Path: "/gateways", RetryAfter: time.Second, Count: 1})
+	start := time.Now()
+	if _, err := client.Gateways(); err != nil || time.Since(start) < time.Second {
+		t.Fatalf("Expected retry after a second but got %v after %v", err, time.Since(start))
+	}
+
+	server.AddFault(congresstest.Fault{Path: "/gateways", MalformedJSON: true, Count: 1})
+	if _, err := client.Gateways(); err == nil {
+		t.Fatal("Expected error decoding malformed JSON")
+	}
+
+	server.AddFault(congresstest.Fault{Path: "/gateways", Latency: 200 * time.Millisecond, Count: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.GatewaysContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded but got %v", err)
+	}
+
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	server.AddFault(congresstest.Fault{Path: "/applications/*", SlowBody: 20 * time.Millisecond, Count: 1})
+	start = time.Now()
+	if _, err := client.GetApplication(app.EUI); err != nil || time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("Expected slow response but got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestStreamFaults(t *testing.T) {
+	server := congresstest.NewServer("")
+	defer server.Close()
+
+	client, err := gocongress.NewCongressClient("", gocongress.WithAddr(server.URL), gocongress.WithInsecureStream(),
+		gocongress.WithStreamReconnect(gocongress.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, _ := client.NewApplication()
+	device, _ := app.NewDevice(gocongress.OTAA)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	data, errs, err := app.DataStreamContext(ctx)
+	if err != nil {
+		t.Fatalf("Couldn't open data stream: %v", err)
+	}
+
+	// Wait for the stream to reconnect after each fault by injecting uplinks
+	// until one gets through
+	waitForData := func(payload string) {
+		deadline := time.After(2 * time.Second)
+		for {
+			server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{StringData: payload})
+			select {
+			case msg := <-data:
+				if msg.StringData == payload {
+					return
+				}
+			case <-time.After(20 * time.Millisecond):
+			case <-deadline:
+				t.Fatal("Stream didn't recover")
+			}
+		}
+	}
+	expectError := func() {
+		select {
+		case <-errs:
+		case <-time.After(time.Second):
+			t.Fatal("Expected error on the stream")
+		}
+	}
+
+	if server.DropStreams(app.EUI) != 1 {
+		t.Fatal("Expected one stream to be dropped")
+	}
+	expectError()
+	waitForData("01")
+
+	server.SendStreamFrame(app.EUI, "not json")
+	expectError()
+	waitForData("02")
+
+	// Error frames close the stream without an error
+	if err := server.SendStreamError(app.EUI, "something broke"); err != nil {
+		t.Fatalf("Couldn't send error frame: %v", err)
+	}
+	select {
+	case _, ok := <-errs:
+		if ok {
+			t.Fatal("Expected the stream to close without an error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Stream wasn't closed after the error frame")
+	}
+}
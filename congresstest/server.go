@@ -0,0 +1,931 @@
+// Package congresstest provides an in-memory Congress server for tests. The
+// server implements the parts of the REST API that gocongress uses,
+// including the application data stream, so code using the client can be
+// tested without network access or an API token. The server doesn't use
+// TLS, so clients that open the data stream need the WithInsecureStream
+// option.
+package congresstest
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// ErrNotFound is returned by the helpers when the application or device
+// doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// The default number of messages returned from the data history
+const defaultLimit = 100
+
+// The number of stream frames buffered for each client
+const streamBuffer = 64
+
+// Application is an application stored in the server
+type Application struct {
+	EUI  string            `json:"applicationEUI"`
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// Device is a device stored in the server
+type Device struct {
+	EUI                   string            `json:"deviceEUI"`
+	DeviceAddress         string            `json:"devAddr"`
+	ApplicationKey        string            `json:"appKey"`
+	ApplicationSessionKey string            `json:"appSKey"`
+	NetworkSessionKey     string            `json:"nwkSKey"`
+	FrameCounterUp        uint16            `json:"fCntUp"`
+	FrameCounterDown      uint16            `json:"fCntDn"`
+	RelaxedCounter        bool              `json:"relaxedCounter"`
+	DeviceType            string            `json:"deviceType"`
+	KeyWarning            bool              `json:"keyWarning"`
+	Tags                  map[string]string `json:"tags,omitempty"`
+}
+
+// Gateway is a gateway stored in the server
+type Gateway struct {
+	EUI       string            `json:"gatewayEUI"`
+	IP        string            `json:"ip,omitempty"`
+	StrictIP  bool              `json:"strictIP"`
+	Latitude  float32           `json:"latitude,omitempty"`
+	Longitude float32           `json:"longitude,omitempty"`
+	Altitude  float32           `json:"altitude,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// Output is an application output stored in the server
+type Output struct {
+	EUI    string                 `json:"eui"`
+	AppEUI string                 `json:"appEUI"`
+	Config map[string]interface{} `json:"config,omitempty"`
+	Status string                 `json:"status,omitempty"`
+}
+
+// DownstreamMessage is a message queued for a device
+type DownstreamMessage struct {
+	StringData  string `json:"data"`
+	Port        uint8  `json:"port"`
+	Ack         bool   `json:"ack"`
+	SentTime    int64  `json:"sentTime"`
+	CreatedTime int64  `json:"createdTime"`
+	AckTime     int64  `json:"ackTime"`
+	State       string `json:"state"`
+}
+
+// Uplink is a message from a device. It's stored in the data history and
+// sent on the application data stream.
+type Uplink struct {
+	DeviceAddress string  `json:"devAddr"`
+	Timestamp     int64   `json:"timestamp"`
+	StringData    string  `json:"data"`
+	AppEUI        string  `json:"appEUI"`
+	DeviceEUI     string  `json:"deviceEUI"`
+	RSSI          int32   `json:"rssi"`
+	SNR           float32 `json:"snr"`
+	Frequency     float32 `json:"frequency"`
+	GatewayEUI    string  `json:"gatewayEUI"`
+	DataRate      string  `json:"dataRate"`
+}
+
+// The server's state for a device
+type deviceState struct {
+	Device
+	queued  *DownstreamMessage
+	history []Uplink
+}
+
+// The server's state for an application
+type appState struct {
+	Application
+	devices map[string]*deviceState
+	outputs map[string]*Output
+	streams map[*subscriber]bool
+}
+
+// subscriber is a client connected to a data stream
+type subscriber struct {
+	frames chan []byte
+	drop   chan struct{}
+	once   sync.Once
+}
+
+// Disconnect the client
+func (sub *subscriber) close() {
+	sub.once.Do(func() {
+		close(sub.drop)
+	})
+}
+
+// Server is an in-memory Congress server. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+	token    string
+	mutex    sync.Mutex
+	apps     map[string]*appState
+	gateways map[string]*Gateway
+	sequence uint64
+	faults   []*faultState
+	done     chan struct{}
+	close    sync.Once
+	paging   bool
+}
+
+// ServerOption configures the server
+type ServerOption func(s *Server)
+
+// WithPaging makes the server page the application, device and gateway
+// lists with the limit and offset parameters, and filter and page the data
+// history with the since, until and offset parameters. Without it the lists
+// are returned in full and the data history only honours the limit, so the
+// server doesn't assume any paging support from Congress.
+func WithPaging() ServerOption {
+	return func(s *Server) {
+		s.paging = true
+	}
+}
+
+// NewServer starts a new server. If the token is set requests must use it,
+// otherwise any token is accepted.
+func NewServer(token string, opts ...ServerOption) *Server {
+	s := &Server{
+		token:    token,
+		apps:     make(map[string]*appState),
+		gateways: make(map[string]*Gateway),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Server = httptest.NewServer(s.routes())
+	return s
+}
+
+// Close shuts down the server and closes the data streams
+func (s *Server) Close() {
+	s.close.Do(func() {
+		close(s.done)
+		s.Server.Close()
+	})
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.root)
+	mux.HandleFunc("GET /applications", s.listApplications)
+	mux.HandleFunc("POST /applications", s.createApplication)
+	mux.HandleFunc("GET /applications/{app}", s.getApplication)
+	mux.HandleFunc("PUT /applications/{app}", s.updateApplication)
+	mux.HandleFunc("DELETE /applications/{app}", s.deleteApplication)
+	mux.HandleFunc("GET /applications/{app}/devices", s.listDevices)
+	mux.HandleFunc("POST /applications/{app}/devices", s.createDevice)
+	mux.HandleFunc("GET /applications/{app}/devices/{dev}", s.getDevice)
+	mux.HandleFunc("PUT /applications/{app}/devices/{dev}", s.updateDevice)
+	mux.HandleFunc("DELETE /applications/{app}/devices/{dev}", s.deleteDevice)
+	mux.HandleFunc("GET /applications/{app}/devices/{dev}/message", s.getMessage)
+	mux.HandleFunc("POST /applications/{app}/devices/{dev}/message", s.enqueueMessage)
+	mux.HandleFunc("DELETE /applications/{app}/devices/{dev}/message", s.clearMessage)
+	mux.HandleFunc("GET /applications/{app}/devices/{dev}/data", s.deviceData)
+	mux.HandleFunc("GET /applications/{app}/outputs", s.listOutputs)
+	mux.HandleFunc("POST /applications/{app}/outputs", s.createOutput)
+	mux.HandleFunc("PUT /applications/{app}/outputs/{output}", s.updateOutput)
+	mux.HandleFunc("DELETE /applications/{app}/outputs/{output}", s.deleteOutput)
+	mux.Handle("GET /applications/{app}/stream", http.HandlerFunc(s.stream))
+	mux.HandleFunc("GET /gateways", s.listGateways)
+	mux.HandleFunc("POST /gateways", s.createGateway)
+	mux.HandleFunc("GET /gateways/{gw}", s.getGateway)
+	mux.HandleFunc("PUT /gateways/{gw}", s.updateGateway)
+	mux.HandleFunc("DELETE /gateways/{gw}", s.deleteGateway)
+	return s.authenticate(s.injectFaults(mux))
+}
+
+// Check the API token before passing on the request
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && r.Header.Get("X-API-Token") != s.token {
+			writeError(w, http.StatusUnauthorized, "Invalid API token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Application returns a copy of the application
+func (s *Server) Application(eui string) (Application, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[eui]
+	if !ok {
+		return Application{}, false
+	}
+	return copyApplication(app.Application), true
+}
+
+// Device returns a copy of the device
+func (s *Server) Device(appEUI, deviceEUI string) (Device, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	device, ok := s.device(appEUI, deviceEUI)
+	if !ok {
+		return Device{}, false
+	}
+	return copyDevice(device.Device), true
+}
+
+// Gateway returns a copy of the gateway
+func (s *Server) Gateway(eui string) (Gateway, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	gw, ok := s.gateways[eui]
+	if !ok {
+		return Gateway{}, false
+	}
+	return copyGateway(*gw), true
+}
+
+// QueuedMessage returns the message queued for the device
+func (s *Server) QueuedMessage(appEUI, deviceEUI string) (DownstreamMessage, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	device, ok := s.device(appEUI, deviceEUI)
+	if !ok || device.queued == nil {
+		return DownstreamMessage{}, false
+	}
+	return *device.queued, true
+}
+
+// InjectUplink adds a message from a device to the device's data history
+// and sends it on the application's data streams. The application EUI,
+// device address and timestamp are filled in if they're not set.
+func (s *Server) InjectUplink(appEUI, deviceEUI string, msg Uplink) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	device, ok := s.device(appEUI, deviceEUI)
+	if !ok {
+		return fmt.Errorf("device %s in application %s: %w", deviceEUI, appEUI, ErrNotFound)
+	}
+	msg.AppEUI = appEUI
+	msg.DeviceEUI = deviceEUI
+	if msg.DeviceAddress == "" {
+		msg.DeviceAddress = device.DeviceAddress
+	}
+	if msg.Timestamp == 0 {
+		msg.Timestamp = timestamp(time.Now())
+	}
+	device.FrameCounterUp++
+	device.history = append(device.history, msg)
+	frame, err := json.Marshal(map[string]interface{}{"type": "DeviceData", "data": msg})
+	if err != nil {
+		return err
+	}
+	s.broadcast(s.apps[appEUI], frame)
+	return nil
+}
+
+// Send a frame to the application's data streams. Frames are dropped for
+// clients that don't keep up.
+func (s *Server) broadcast(app *appState, frame []byte) {
+	for sub := range app.streams {
+		select {
+		case sub.frames <- frame:
+		default:
+		}
+	}
+}
+
+func (s *Server) device(appEUI, deviceEUI string) (*deviceState, bool) {
+	app, ok := s.apps[appEUI]
+	if !ok {
+		return nil, false
+	}
+	device, ok := app.devices[deviceEUI]
+	return device, ok
+}
+
+// Make a new EUI. Must be called with the mutex held.
+func (s *Server) newEUI() string {
+	s.sequence++
+	buf := make([]byte, 8)
+	for i := range buf {
+		buf[i] = byte(s.sequence >> (56 - 8*i))
+	}
+	buf[0] = 0x02
+	ret := ""
+	for i, b := range buf {
+		if i > 0 {
+			ret += "-"
+		}
+		ret += fmt.Sprintf("%02x", b)
+	}
+	return ret
+}
+
+func (s *Server) root(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"applications": "/applications",
+		"gateways":     "/gateways",
+	})
+}
+
+func (s *Server) listApplications(w http.ResponseWriter, r *http.Request) {
+	offset, limit, ok := s.pageParams(w, r, -1)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ret := []Application{}
+	for _, eui := range paged(sortedKeys(s.apps), offset, limit) {
+		ret = append(ret, copyApplication(s.apps[eui].Application))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"applications": ret})
+}
+
+func (s *Server) createApplication(w http.ResponseWriter, r *http.Request) {
+	app := Application{}
+	if !readJSON(w, r, &app) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app.EUI = s.newEUI()
+	s.apps[app.EUI] = &appState{
+		Application: copyApplication(app),
+		devices:     make(map[string]*deviceState),
+		outputs:     make(map[string]*Output),
+		streams:     make(map[*subscriber]bool),
+	}
+	writeJSON(w, http.StatusCreated, app)
+}
+
+func (s *Server) getApplication(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[r.PathValue("app")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown application")
+		return
+	}
+	writeJSON(w, http.StatusOK, copyApplication(app.Application))
+}
+
+func (s *Server) updateApplication(w http.ResponseWriter, r *http.Request) {
+	update := Application{}
+	if !readJSON(w, r, &update) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[r.PathValue("app")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown application")
+		return
+	}
+	app.Tags = copyTags(update.Tags)
+	writeJSON(w, http.StatusOK, copyApplication(app.Application))
+}
+
+func (s *Server) deleteApplication(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	eui := r.PathValue("app")
+	app, ok := s.apps[eui]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown application")
+		return
+	}
+	for sub := range app.streams {
+		sub.close()
+	}
+	delete(s.apps, eui)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request) {
+	offset, limit, ok := s.pageParams(w, r, -1)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[r.PathValue("app")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown application")
+		return
+	}
+	ret := []Device{}
+	for _, eui := range paged(sortedKeys(app.devices), offset, limit) {
+		ret = append(ret, copyDevice(app.devices[eui].Device))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"devices": ret})
+}
+
+func (s *Server) createDevice(w http.ResponseWriter, r *http.Request) {
+	device := Device{}
+	if !readJSON(w, r, &device) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[r.PathValue("app")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown application")
+		return
+	}
+	switch device.DeviceType {
+	case "OTAA":
+		if device.ApplicationKey == "" {
+			device.ApplicationKey = randomHex(16)
+		}
+	case "ABP":
+		if device.DeviceAddress == "" {
+			device.DeviceAddress = randomHex(4)
+		}
+		if device.ApplicationSessionKey == "" {
+			device.ApplicationSessionKey = randomHex(16)
+		}
+		if device.NetworkSessionKey == "" {
+			device.NetworkSessionKey = randomHex(16)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "Device type must be OTAA or ABP")
+		return
+	}
+	if device.EUI == "" {
+		device.EUI = s.newEUI()
+	}
+	if _, exists := app.devices[device.EUI]; exists {
+		writeError(w, http.StatusConflict, "Device already exists")
+		return
+	}
+	app.devices[device.EUI] = &deviceState{Device: copyDevice(device)}
+	writeJSON(w, http.StatusCreated, device)
+}
+
+func (s *Server) getDevice(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	device, ok := s.device(r.PathValue("app"), r.PathValue("dev"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown device")
+		return
+	}
+	writeJSON(w, http.StatusOK, copyDevice(device.Device))
+}
+
+func (s *Server) updateDevice(w http.ResponseWriter, r *http.Request) {
+	update := Device{}
+	if !readJSON(w, r, &update) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	device, ok := s.device(r.PathValue("app"), r.PathValue("dev"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown device")
+		return
+	}
+	update.EUI = device.EUI
+	if update.DeviceType == "" {
+		update.DeviceType = device.DeviceType
+	}
+	device.Device = copyDevice(update)
+	writeJSON(w, http.StatusOK, copyDevice(device.Device))
+}
+
+func (s *Server) deleteDevice(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[r.PathValue("app")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown application")
+		return
+	}
+	eui := r.PathValue("dev")
+	if _, ok := app.devices[eui]; !ok {
+		writeError(w, http.StatusNotFound, "Unknown device")
+		return
+	}
+	delete(app.devices, eui)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getMessage(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	device, ok := s.device(r.PathValue("app"), r.PathValue("dev"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown device")
+		return
+	}
+	if device.queued == nil {
+		writeError(w, http.StatusNotFound, "No message queued")
+		return
+	}
+	writeJSON(w, http.StatusOK, device.queued)
+}
+
+func (s *Server) enqueueMessage(w http.ResponseWriter, r *http.Request) {
+	msg := DownstreamMessage{}
+	if !readJSON(w, r, &msg) {
+		return
+	}
+	if _, err := hex.DecodeString(msg.StringData); err != nil {
+		writeError(w, http.StatusBadRequest, "Data must be hex encoded")
+		return
+	}
+	if msg.Port < 1 || msg.Port > 224 {
+		writeError(w, http.StatusBadRequest, "Port must be between 1 and 224")
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	device, ok := s.device(r.PathValue("app"), r.PathValue("dev"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown device")
+		return
+	}
+	if device.queued != nil {
+		writeError(w, http.StatusConflict, "A message is already queued")
+		return
+	}
+	msg.CreatedTime = timestamp(time.Now())
+	msg.SentTime = 0
+	msg.AckTime = 0
+	msg.State = "UNSENT"
+	device.queued = &msg
+	writeJSON(w, http.StatusCreated, msg)
+}
+
+func (s *Server) clearMessage(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	device, ok := s.device(r.PathValue("app"), r.PathValue("dev"))
+	if !ok || device.queued == nil {
+		writeError(w, http.StatusNotFound, "No message queued")
+		return
+	}
+	device.queued = nil
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Return the data history with the newest message first. With paging the
+// since and until parameters are timestamps; since is inclusive and until
+// exclusive.
+func (s *Server) deviceData(w http.ResponseWriter, r *http.Request) {
+	offset, limit, ok := s.pageParams(w, r, defaultLimit)
+	if !ok {
+		return
+	}
+	since, until := int64(math.MinInt64), int64(math.MaxInt64)
+	for name, val := range map[string]*int64{"since": &since, "until": &until} {
+		if param := r.URL.Query().Get(name); param != "" && s.paging {
+			n, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid "+name)
+				return
+			}
+			*val = n
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	device, ok := s.device(r.PathValue("app"), r.PathValue("dev"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown device")
+		return
+	}
+	ret := []Uplink{}
+	for i := len(device.history) - 1; i >= 0; i-- {
+		if msg := device.history[i]; msg.Timestamp >= since && msg.Timestamp < until {
+			ret = append(ret, msg)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Timestamp > ret[j].Timestamp
+	})
+	ret = ret[min(offset, len(ret)):]
+	ret = ret[:min(limit, len(ret))]
+	writeJSON(w, http.StatusOK, map[string]interface{}{"messages": ret})
+}
+
+func (s *Server) listOutputs(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[r.PathValue("app")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown application")
+		return
+	}
+	ret := []Output{}
+	for _, eui := range sortedKeys(app.outputs) {
+		ret = append(ret, *app.outputs[eui])
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"outputs": ret})
+}
+
+func (s *Server) createOutput(w http.ResponseWriter, r *http.Request) {
+	output := Output{}
+	if !readJSON(w, r, &output) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[r.PathValue("app")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown application")
+		return
+	}
+	output.EUI = s.newEUI()
+	output.AppEUI = app.EUI
+	output.Status = "running"
+	app.outputs[output.EUI] = &output
+	writeJSON(w, http.StatusCreated, output)
+}
+
+func (s *Server) updateOutput(w http.ResponseWriter, r *http.Request) {
+	update := Output{}
+	if !readJSON(w, r, &update) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[r.PathValue("app")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown application")
+		return
+	}
+	output, ok := app.outputs[r.PathValue("output")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown output")
+		return
+	}
+	output.Config = update.Config
+	writeJSON(w, http.StatusOK, output)
+}
+
+func (s *Server) deleteOutput(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	app, ok := s.apps[r.PathValue("app")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown application")
+		return
+	}
+	eui := r.PathValue("output")
+	if _, ok := app.outputs[eui]; !ok {
+		writeError(w, http.StatusNotFound, "Unknown output")
+		return
+	}
+	delete(app.outputs, eui)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Serve the application's data stream. The web socket is closed when the
+// application is removed or the server is closed.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	app, ok := s.apps[r.PathValue("app")]
+	if !ok {
+		s.mutex.Unlock()
+		writeError(w, http.StatusNotFound, "Unknown application")
+		return
+	}
+	sub := &subscriber{frames: make(chan []byte, streamBuffer), drop: make(chan struct{})}
+	app.streams[sub] = true
+	s.mutex.Unlock()
+
+	websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		defer s.unsubscribe(app, sub)
+
+		closed := make(chan struct{})
+		go func() {
+			// Read until the client goes away
+			var buf []byte
+			for websocket.Message.Receive(ws, &buf) == nil {
+			}
+			close(closed)
+		}()
+		for {
+			select {
+			case frame := <-sub.frames:
+				if err := websocket.Message.Send(ws, string(frame)); err != nil {
+					return
+				}
+			case <-sub.drop:
+				return
+			case <-closed:
+				return
+			case <-s.done:
+				return
+			}
+		}
+	}).ServeHTTP(w, r)
+}
+
+func (s *Server) unsubscribe(app *appState, sub *subscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(app.streams, sub)
+}
+
+func (s *Server) listGateways(w http.ResponseWriter, r *http.Request) {
+	offset, limit, ok := s.pageParams(w, r, -1)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ret := []Gateway{}
+	for _, eui := range paged(sortedKeys(s.gateways), offset, limit) {
+		ret = append(ret, copyGateway(*s.gateways[eui]))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"gateways": ret})
+}
+
+func (s *Server) createGateway(w http.ResponseWriter, r *http.Request) {
+	gw := Gateway{}
+	if !readJSON(w, r, &gw) {
+		return
+	}
+	if gw.EUI == "" {
+		writeError(w, http.StatusBadRequest, "Missing gateway EUI")
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.gateways[gw.EUI]; exists {
+		writeError(w, http.StatusConflict, "Gateway already exists")
+		return
+	}
+	gw = copyGateway(gw)
+	s.gateways[gw.EUI] = &gw
+	writeJSON(w, http.StatusCreated, gw)
+}
+
+func (s *Server) getGateway(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	gw, ok := s.gateways[r.PathValue("gw")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown gateway")
+		return
+	}
+	writeJSON(w, http.StatusOK, copyGateway(*gw))
+}
+
+func (s *Server) updateGateway(w http.ResponseWriter, r *http.Request) {
+	update := Gateway{}
+	if !readJSON(w, r, &update) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	gw, ok := s.gateways[r.PathValue("gw")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown gateway")
+		return
+	}
+	update.EUI = gw.EUI
+	*gw = copyGateway(update)
+	writeJSON(w, http.StatusOK, copyGateway(*gw))
+}
+
+func (s *Server) deleteGateway(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	eui := r.PathValue("gw")
+	if _, ok := s.gateways[eui]; !ok {
+		writeError(w, http.StatusNotFound, "Unknown gateway")
+		return
+	}
+	delete(s.gateways, eui)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Read the offset and limit parameters. A negative limit returns everything.
+// Lists have a negative default limit and are only paged if the server has
+// paging; the limit of the data history is always used. An error response
+// is written if the parameters are invalid.
+func (s *Server) pageParams(w http.ResponseWriter, r *http.Request, limit int) (int, int, bool) {
+	offset := 0
+	params := map[string]*int{"limit": &limit}
+	switch {
+	case s.paging:
+		params["offset"] = &offset
+	case limit < 0:
+		return offset, limit, true
+	}
+	for name, val := range params {
+		param := r.URL.Query().Get(name)
+		if param == "" {
+			continue
+		}
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid "+name)
+			return 0, 0, false
+		}
+		*val = n
+	}
+	return offset, limit, true
+}
+
+// Return the part of the list selected by the offset and limit
+func paged(list []string, offset, limit int) []string {
+	list = list[min(offset, len(list)):]
+	if limit >= 0 && limit < len(list) {
+		list = list[:limit]
+	}
+	return list
+}
+
+// Decode the request body. An error response is written if it fails.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON in request body")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{"message": message, "status": status})
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Timestamps are milliseconds since epoch
+func timestamp(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	ret := make([]string, 0, len(m))
+	for key := range m {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	ret := make(map[string]string, len(tags))
+	for k, v := range tags {
+		ret[k] = v
+	}
+	return ret
+}
+
+func copyApplication(app Application) Application {
+	app.Tags = copyTags(app.Tags)
+	return app
+}
+
+func copyDevice(device Device) Device {
+	device.Tags = copyTags(device.Tags)
+	return device
+}
+
+func copyGateway(gw Gateway) Gateway {
+	gw.Tags = copyTags(gw.Tags)
+	return gw
+}
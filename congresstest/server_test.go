@@ -0,0 +1,144 @@
+package congresstest_test
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregersrygg/gocongress"
+	"github.com/gregersrygg/gocongress/congresstest"
+)
+
+func TestServer(t *testing.T) {
+	server := congresstest.NewServer("secret")
+	defer server.Close()
+
+	if _, err := gocongress.NewCongressClient("wrong", gocongress.WithAddr(server.URL)); !errors.Is(err, gocongress.ErrUnauthorized) {
+		t.Fatalf("Expected unauthorized but got %v", err)
+	}
+	client, err := gocongress.NewCongressClient("secret", gocongress.WithAddr(server.URL), gocongress.WithInsecureStream())
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	otaa, err := app.NewDevice(gocongress.OTAA)
+	if err != nil || len(otaa.ApplicationKey) != 32 {
+		t.Fatalf("Expected OTAA device with app key but got %+v (%v)", otaa, err)
+	}
+	abp, err := app.NewDevice(gocongress.ABP)
+	if err != nil || len(abp.DeviceAddress) != 8 || len(abp.NetworkSessionKey) != 32 || len(abp.ApplicationSessionKey) != 32 {
+		t.Fatalf("Expected ABP device with session keys but got %+v (%v)", abp, err)
+	}
+
+	data, errs, err := app.DataStream()
+	if err != nil {
+		t.Fatalf("Couldn't open data stream: %v", err)
+	}
+
+	for _, payload := range []string{"01", "02"} {
+		if err := server.InjectUplink(app.EUI, otaa.EUI, congresstest.Uplink{StringData: payload}); err != nil {
+			t.Fatalf("Couldn't inject uplink: %v", err)
+		}
+	}
+	for _, payload := range []string{"01", "02"} {
+		select {
+		case msg := <-data:
+			if msg.StringData != payload || msg.DeviceEUI != otaa.EUI || msg.ApplicationEUI != app.EUI {
+				t.Fatalf("Unexpected message on stream: %+v", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Didn't receive uplink on stream")
+		}
+	}
+
+	history, err := otaa.Messages(1)
+	if err != nil || len(history) != 1 || history[0].StringData != "02" {
+		t.Fatalf("Expected newest message in history but got %v (%v)", history, err)
+	}
+	if err := server.InjectUplink(app.EUI, "00-00", congresstest.Uplink{}); !errors.Is(err, congresstest.ErrNotFound) {
+		t.Fatalf("Expected not found for unknown device but got %v", err)
+	}
+
+	if _, err := otaa.EnqueueMessage([]byte{0xBE, 0xEF}, 2, false); err != nil {
+		t.Fatalf("Couldn't enqueue message: %v", err)
+	}
+	if msg, ok := server.QueuedMessage(app.EUI, otaa.EUI); !ok || msg.StringData != "beef" || msg.Port != 2 {
+		t.Fatalf("Unexpected queued message: %+v", msg)
+	}
+
+	if err := app.Delete(); err != nil {
+		t.Fatalf("Couldn't delete application: %v", err)
+	}
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("Stream wasn't closed when the application was removed")
+	}
+	if _, ok := <-data; ok {
+		t.Fatal("Expected stream to close")
+	}
+	if _, ok := server.Application(app.EUI); ok {
+		t.Fatal("Application still exists")
+	}
+}
+
+func TestPaging(t *testing.T) {
+	for _, paging := range []bool{false, true} {
+		var opts []congresstest.ServerOption
+		if paging {
+			opts = append(opts, congresstest.WithPaging())
+		}
+		server := congresstest.NewServer("", opts...)
+		defer server.Close()
+		for i := 0; i < 5; i++ {
+			resp, err := http.Post(server.URL+"/gateways", "application/json", strings.NewReader(fmt.Sprintf(`{"gatewayEUI":"00-%02d"}`, i)))
+			if err != nil {
+				t.Fatalf("Got error creating gateway: %v", err)
+			}
+			resp.Body.Close()
+		}
+
+		resp, err := http.Get(server.URL + "/gateways?limit=2&offset=1")
+		if err != nil {
+			t.Fatalf("Got error listing gateways: %v", err)
+		}
+		var list struct {
+			Gateways []congresstest.Gateway `json:"gateways"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Got error decoding gateways: %v", err)
+		}
+		if expected := map[bool]int{false: 5, true: 2}[paging]; len(list.Gateways) != expected {
+			t.Fatalf("Expected %d gateways (paging=%v) but got %d", expected, paging, len(list.Gateways))
+		}
+		if paging && list.Gateways[0].EUI != "00-01" {
+			t.Fatalf("Expected the page to start at the offset but got %s", list.Gateways[0].EUI)
+		}
+	}
+}
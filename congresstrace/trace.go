@@ -0,0 +1,137 @@
+// Package congresstrace adds OpenTelemetry spans to gocongress clients.
+package congresstrace
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"strings"
+
+	"github.com/gregersrygg/gocongress"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/gregersrygg/gocongress"
+
+// Span attributes for the entities involved in an operation
+const (
+	ApplicationEUIKey = attribute.Key("congress.application.eui")
+	DeviceEUIKey      = attribute.Key("congress.device.eui")
+	GatewayEUIKey     = attribute.Key("congress.gateway.eui")
+)
+
+// Option configures the tracing middleware
+type Option func(cfg *config)
+
+type config struct {
+	propagator propagation.TextMapPropagator
+}
+
+// WithPropagator sets the propagator used to send the trace context to
+// Congress. The global propagator from otel.GetTextMapPropagator is used
+// by default.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(cfg *config) {
+		cfg.propagator = propagator
+	}
+}
+
+// WithTracerProvider makes the client create a span for every operation.
+// The trace context is propagated to Congress in the request headers.
+func WithTracerProvider(provider trace.TracerProvider, opts ...Option) gocongress.Option {
+	return gocongress.WithTracing(Middleware(provider, opts...))
+}
+
+// Middleware returns middleware that wraps each call in a span. Use
+// WithTracerProvider to add it to a client so the span covers the client's
+// logging, metrics and journal.
+func Middleware(provider trace.TracerProvider, opts ...Option) gocongress.Middleware {
+	tracer := provider.Tracer(tracerName)
+	cfg := config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(next gocongress.Handler) gocongress.Handler {
+		return func(call *gocongress.Call) error {
+			propagator := cfg.propagator
+			if propagator == nil {
+				propagator = otel.GetTextMapPropagator()
+			}
+			ctx, span := tracer.Start(call.Request.Context(), call.Operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("http.request.method", call.Request.Method),
+					attribute.String("url.path", call.Request.URL.Path),
+				))
+			defer span.End()
+
+			call.Request = call.Request.WithContext(ctx)
+			propagator.Inject(ctx, propagation.HeaderCarrier(call.Request.Header))
+
+			err := next(call)
+
+			span.SetAttributes(resourceEUIs(call)...)
+			if call.Response != nil {
+				span.SetAttributes(attribute.Int("http.response.status_code", call.Response.StatusCode))
+			}
+			if call.Attempts > 1 {
+				span.SetAttributes(attribute.Int("congress.retries", call.Attempts-1))
+			}
+			if err != nil {
+				if status := gocongress.ErrorStatusCode(err); status != 0 {
+					span.SetAttributes(attribute.Int("http.response.status_code", status))
+				}
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+	}
+}
+
+// Find the EUIs of the entities in a call. The EUIs are taken from the
+// resource path and, for new entities, from the decoded result.
+func resourceEUIs(call *gocongress.Call) []attribute.KeyValue {
+	var ret []attribute.KeyValue
+	parts := strings.Split(strings.Trim(call.Request.URL.Path, "/"), "/")
+	for i := 0; i+1 < len(parts); i += 2 {
+		switch parts[i] {
+		case "applications":
+			ret = append(ret, ApplicationEUIKey.String(parts[i+1]))
+		case "devices":
+			ret = append(ret, DeviceEUIKey.String(parts[i+1]))
+		case "gateways":
+			ret = append(ret, GatewayEUIKey.String(parts[i+1]))
+		}
+	}
+	if len(parts)%2 == 0 {
+		return ret
+	}
+	// The path is a collection so this might be a new entity
+	switch entity := call.Result.(type) {
+	case *gocongress.Application:
+		ret = append(ret, ApplicationEUIKey.String(entity.EUI))
+	case *gocongress.Device:
+		ret = append(ret, DeviceEUIKey.String(entity.EUI))
+	case *gocongress.Gateway:
+		ret = append(ret, GatewayEUIKey.String(entity.EUI))
+	}
+	return ret
+}
@@ -0,0 +1,125 @@
+package congresstrace
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gregersrygg/gocongress"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		switch {
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case r.URL.Path == "/applications/00-01":
+			w.Write([]byte(`{"applicationEUI":"00-01"}`))
+			return
+		}
+		w.Write([]byte(`{"deviceEUI":"00-02"}`))
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	client, err := gocongress.NewCongressClient("", gocongress.WithAddr(server.URL), gocongress.WithoutPing(),
+		WithTracerProvider(provider, WithPropagator(propagation.TraceContext{})))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+
+	app, err := client.GetApplication("00-01")
+	if err != nil {
+		t.Fatalf("Got error retrieving application: %v", err)
+	}
+	exporter.Reset()
+	device, err := app.NewDevice(gocongress.OTAA)
+	if err != nil {
+		t.Fatalf("Got error creating device: %v", err)
+	}
+	if traceparent == "" {
+		t.Fatal("Trace context isn't propagated")
+	}
+	if err := device.Delete(); gocongress.ErrorStatusCode(err) != http.StatusNotFound {
+		t.Fatalf("Expected 404 but got %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans but got %d", len(spans))
+	}
+	attrs := func(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+		ret := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes {
+			ret[kv.Key] = kv.Value
+		}
+		return ret
+	}
+
+	create := attrs(spans[0])
+	if spans[0].Name != "Application.NewDevice" || create[ApplicationEUIKey].AsString() != "00-01" || create[DeviceEUIKey].AsString() != "00-02" {
+		t.Fatalf("Unexpected span for new device: %s %v", spans[0].Name, create)
+	}
+	del := attrs(spans[1])
+	if spans[1].Name != "Device.Delete" || del[DeviceEUIKey].AsString() != "00-02" || del["http.response.status_code"].AsInt64() != 404 {
+		t.Fatalf("Unexpected span for delete: %s %v", spans[1].Name, del)
+	}
+	if spans[1].Status.Code != codes.Error || len(spans[1].Events) == 0 {
+		t.Fatalf("Error isn't recorded on span: %+v", spans[1].Status)
+	}
+}
+
+func TestGlobalPropagator(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		w.Write([]byte(`{"gateways":[]}`))
+	}))
+	defer server.Close()
+
+	previous := otel.GetTextMapPropagator()
+	defer otel.SetTextMapPropagator(previous)
+	otel.SetTextMapPropagator(propagation.Baggage{})
+
+	provider := sdktrace.NewTracerProvider()
+	client, err := gocongress.NewCongressClient("", gocongress.WithAddr(server.URL), gocongress.WithoutPing(), WithTracerProvider(provider))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	member, _ := baggage.NewMember("tenant", "acme")
+	bag, _ := baggage.New(member)
+	if _, err := client.GatewaysContext(baggage.ContextWithBaggage(context.Background(), bag)); err != nil {
+		t.Fatalf("Got error retrieving gateways: %v", err)
+	}
+	if header.Get("baggage") != "tenant=acme" || header.Get("traceparent") != "" {
+		t.Fatalf("Expected the global propagator to be used but got %v", header)
+	}
+}
@@ -17,6 +17,7 @@ package gocongress
  */
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"net/http"
@@ -52,6 +53,7 @@ type Device struct {
 	tagResource
 	client *CongressClient
 	app    *Application
+	rev    entityRevision
 }
 
 // DownstreamMessage are messages sent to the devices
@@ -113,57 +115,80 @@ func (u *UpstreamMessage) Data() []byte {
 
 // Update updates the device in the Congress backend. The updated device is returned.
 func (device *Device) Update() (*Device, error) {
-	ret, err := device.client.genericMutation(http.MethodPut, fmt.Sprintf("/applications/%s/devices/%s", device.app.EUI, device.EUI), device)
-	if ret == nil {
-		return nil, err
-	}
-	return ret.(*Device), err
+	return device.UpdateContext(context.Background())
+}
+
+// UpdateContext updates the device in the Congress backend using the provided
+// context. The updated device is returned.
+func (device *Device) UpdateContext(ctx context.Context) (*Device, error) {
+	return genericMutation(ctx, device.client, "Device.Update", http.MethodPut, fmt.Sprintf("/applications/%s/devices/%s", device.app.EUI, device.EUI), device)
 }
 
 // Delete removes the device from Congress
 func (device *Device) Delete() error {
-	return device.client.genericDelete(fmt.Sprintf("/applications/%s/devices/%s", device.app.EUI, device.EUI))
+	return device.DeleteContext(context.Background())
+}
+
+// DeleteContext removes the device from Congress using the provided context
+func (device *Device) DeleteContext(ctx context.Context) error {
+	return device.client.genericDelete(ctx, "Device.Delete", fmt.Sprintf("/applications/%s/devices/%s", device.app.EUI, device.EUI))
 }
 
 // EnqueueMessage enqueues a new downstream message to a device. The message will be sent the next
 // time the device sends a packet upstream
 func (device *Device) EnqueueMessage(data []byte, port uint8, ack bool) (*DownstreamMessage, error) {
+	return device.EnqueueMessageContext(context.Background(), data, port, ack)
+}
+
+// EnqueueMessageContext enqueues a new downstream message to a device using the
+// provided context.
+func (device *Device) EnqueueMessageContext(ctx context.Context, data []byte, port uint8, ack bool) (*DownstreamMessage, error) {
 	if port < 1 || port > 224 {
 		return nil, ErrInvalidPort
 	}
 	newMsg := &DownstreamMessage{hex.EncodeToString(data), port, ack, 0, 0, 0, ""}
-	ret, err := device.client.genericMutation(http.MethodPost, fmt.Sprintf("/applications/%s/devices/%s/message", device.app.EUI, device.EUI), newMsg)
-	if ret == nil {
-		return nil, err
-	}
-	return ret.(*DownstreamMessage), err
+	return genericMutation(ctx, device.client, "Device.EnqueueMessage", http.MethodPost, fmt.Sprintf("/applications/%s/devices/%s/message", device.app.EUI, device.EUI), newMsg)
 }
 
 // GetQueuedMessage retrieves the currently queued downstream message
 func (device *Device) GetQueuedMessage() (*DownstreamMessage, error) {
+	return device.GetQueuedMessageContext(context.Background())
+}
+
+// GetQueuedMessageContext retrieves the currently queued downstream message
+// using the provided context
+func (device *Device) GetQueuedMessageContext(ctx context.Context) (*DownstreamMessage, error) {
 	msg := &DownstreamMessage{}
-	ret, err := device.client.genericGet(fmt.Sprintf("/applications/%s/devices/%s/message", device.app.EUI, device.EUI), msg)
-	if ret == nil {
-		return nil, err
-	}
-	return ret.(*DownstreamMessage), err
+	return genericGet(ctx, device.client, "Device.GetQueuedMessage", fmt.Sprintf("/applications/%s/devices/%s/message", device.app.EUI, device.EUI), msg)
 }
 
 // ClearEnqueuedMessage removes the enqueued downstream message
 func (device *Device) ClearEnqueuedMessage() error {
-	return device.client.genericDelete(fmt.Sprintf("/applications/%s/devices/%s/message", device.app.EUI, device.EUI))
+	return device.ClearEnqueuedMessageContext(context.Background())
+}
+
+// ClearEnqueuedMessageContext removes the enqueued downstream message using the
+// provided context
+func (device *Device) ClearEnqueuedMessageContext(ctx context.Context) error {
+	return device.client.genericDelete(ctx, "Device.ClearEnqueuedMessage", fmt.Sprintf("/applications/%s/devices/%s/message", device.app.EUI, device.EUI))
 }
 
 // Messages returns the number of upstream messages sent from the device
 func (device *Device) Messages(limit int) ([]UpstreamMessage, error) {
+	return device.MessagesContext(context.Background(), limit)
+}
+
+// MessagesContext returns the number of upstream messages sent from the device
+// using the provided context
+func (device *Device) MessagesContext(ctx context.Context, limit int) ([]UpstreamMessage, error) {
 
 	type msgList struct {
 		Msgs []UpstreamMessage `json:"messages"`
 	}
 
-	ret, err := device.client.genericGet(fmt.Sprintf("/applications/%s/devices/%s/data?limit=%d", device.app.EUI, device.EUI, limit), &msgList{})
+	ret, err := genericGet(ctx, device.client, "Device.Messages", fmt.Sprintf("/applications/%s/devices/%s/data?limit=%d", device.app.EUI, device.EUI, limit), &msgList{})
 	if err != nil {
 		return nil, err
 	}
-	return ret.(*msgList).Msgs, err
+	return ret.Msgs, nil
 }
@@ -135,3 +135,25 @@ func TestMultipleDevices(t *testing.T) {
 
 	app.Delete()
 }
+
+func BenchmarkMessages(b *testing.B) {
+	messages := make([]UpstreamMessage, 5000)
+	for i := range messages {
+		messages[i] = UpstreamMessage{DeviceAddress: "01020304", Timestamp: int64(i), StringData: "0102030405060708", DeviceEUI: "00-02", AppEUI: "00-01", GatewayEUI: "00-03", DataRate: "SF7BW125"}
+	}
+	server := benchmarkServer(b, map[string]interface{}{"messages": messages})
+	defer server.Close()
+
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing())
+	if err != nil {
+		b.Fatalf("Got error creating client: %v", err)
+	}
+	device := client.device("00-01", "00-02")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := device.Messages(len(messages)); err != nil {
+			b.Fatalf("Got error retrieving messages: %v", err)
+		}
+	}
+}
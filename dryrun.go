@@ -0,0 +1,138 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// PlannedOperation is a mutation recorded by a dry run client.
+type PlannedOperation struct {
+	Operation string          `json:"operation"`
+	Method    string          `json:"method"`
+	Path      string          `json:"path"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// Plan is the ordered list of mutations a dry run client would have sent. It
+// is safe for concurrent use.
+type Plan struct {
+	mutex      sync.Mutex
+	operations []PlannedOperation
+}
+
+// NewPlan creates an empty plan.
+func NewPlan() *Plan {
+	return &Plan{}
+}
+
+// WithDryRun makes the client record POST, PUT and DELETE requests in the
+// plan instead of sending them. GET requests are sent as usual. The mutations
+// return the entity that was sent; new applications, devices and outputs get
+// a generated EUI with a "dryrun-" prefix so they can be used in later calls.
+// The plan contains the payloads as they would be sent, including device
+// keys.
+func WithDryRun(plan *Plan) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.plan = plan
+	}
+}
+
+// Operations returns the recorded mutations in order.
+func (p *Plan) Operations() []PlannedOperation {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]PlannedOperation(nil), p.operations...)
+}
+
+// String returns the plan as a numbered list
+func (p *Plan) String() string {
+	buf := &strings.Builder{}
+	for i, op := range p.Operations() {
+		fmt.Fprintf(buf, "%d. %s %s (%s)", i+1, op.Method, op.Path, op.Operation)
+		if len(op.Payload) > 0 {
+			fmt.Fprintf(buf, " %s", op.Payload)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// MarshalJSON returns the plan as a JSON array
+func (p *Plan) MarshalJSON() ([]byte, error) {
+	ops := p.Operations()
+	if ops == nil {
+		ops = []PlannedOperation{}
+	}
+	return json.Marshal(ops)
+}
+
+// WriteJSON writes the plan as indented JSON
+func (p *Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// Record the mutation in the call and fill in the synthetic result
+func (p *Plan) record(call *Call) error {
+	op := PlannedOperation{
+		Operation: call.Operation,
+		Method:    call.Request.Method,
+		Path:      call.Request.URL.RequestURI(),
+	}
+	if call.Request.GetBody != nil {
+		body, err := call.Request.GetBody()
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		buf, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		if buf = bytes.TrimSpace(buf); len(buf) > 0 {
+			op.Payload = json.RawMessage(buf)
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.operations = append(p.operations, op)
+	call.decoded = call.Result != nil
+	eui := fmt.Sprintf("dryrun-%d", len(p.operations))
+	switch entity := call.Result.(type) {
+	case *Application:
+		if entity.EUI == "" {
+			entity.EUI = eui
+		}
+	case *Device:
+		if entity.EUI == "" {
+			entity.EUI = eui
+		}
+	case *AppOutput:
+		if entity.EUI == "" {
+			entity.EUI = eui
+		}
+	}
+	return nil
+}
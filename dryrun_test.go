@@ -0,0 +1,84 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	var mutations int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			mutations++
+		}
+		w.Write([]byte(`{"applicationEUI":"00-01"}`))
+	}))
+	defer server.Close()
+
+	plan := NewPlan()
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithDryRun(plan))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+
+	app, err := client.GetApplication("00-01")
+	if err != nil {
+		t.Fatalf("Got error retrieving application: %v", err)
+	}
+	device, err := app.NewDevice(OTAA)
+	if err != nil || device.EUI != "dryrun-1" {
+		t.Fatalf("Expected synthetic device but got %v (%v)", device, err)
+	}
+	device.SetTag("name", "planned")
+	if _, err := device.Update(); err != nil {
+		t.Fatalf("Got error updating device: %v", err)
+	}
+	if err := app.Delete(); err != nil {
+		t.Fatalf("Got error deleting application: %v", err)
+	}
+	if mutations != 0 {
+		t.Fatalf("Dry run sent %d mutations", mutations)
+	}
+
+	ops := plan.Operations()
+	if len(ops) != 3 || ops[0].Operation != "Application.NewDevice" || ops[1].Path != "/applications/00-01/devices/dryrun-1" || ops[2].Method != http.MethodDelete {
+		t.Fatalf("Unexpected plan: %+v", ops)
+	}
+	if !strings.Contains(plan.String(), "2. PUT /applications/00-01/devices/dryrun-1 (Device.Update)") {
+		t.Fatalf("Unexpected plan text:\n%s", plan)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := plan.WriteJSON(buf); err != nil {
+		t.Fatalf("Couldn't write plan: %v", err)
+	}
+	var exported []PlannedOperation
+	if err := json.Unmarshal(buf.Bytes(), &exported); err != nil || len(exported) != 3 {
+		t.Fatalf("Couldn't read exported plan: %v", err)
+	}
+	var payload map[string]interface{}
+	json.Unmarshal(exported[1].Payload, &payload)
+	if payload["tags"].(map[string]interface{})["name"] != "planned" {
+		t.Fatalf("Payload isn't recorded: %s", exported[1].Payload)
+	}
+}
@@ -17,6 +17,8 @@ package gocongress
  */
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -29,39 +31,128 @@ var (
 	ErrInvalidPort = &CongressError{Message: "Invalid port number", StatusCode: http.StatusBadRequest}
 )
 
-// CongressError contains the error messages emitted by Congress
+// Sentinel errors for the different classes of errors returned by Congress.
+// Use errors.Is to check if an error belongs to one of the classes.
+var (
+	// ErrNotFound matches 404 (Not Found) errors
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized matches 401 (Unauthorized) errors
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden matches 403 (Forbidden) errors
+	ErrForbidden = errors.New("forbidden")
+	// ErrConflict matches 409 (Conflict) and 412 (Precondition Failed) errors
+	ErrConflict = errors.New("conflict")
+	// ErrRateLimited matches 429 (Too Many Requests) errors
+	ErrRateLimited = errors.New("rate limited")
+	// ErrServer matches 5xx errors
+	ErrServer = errors.New("server error")
+)
+
+// CongressError contains the error messages emitted by Congress. Network
+// errors and errors decoding the response are wrapped in a CongressError
+// with a StatusCode of 0; use errors.Unwrap to get the underlying error.
 type CongressError struct {
 	Message    string
 	StatusCode int
+	// Operation is the name of the operation that failed, f.e. "Device.Update"
+	Operation string
+	// Path is the path of the resource
+	Path string
+	// Body is the raw response body
+	Body string
+	// Fields holds the fields of the response body if it is a JSON object
+	Fields map[string]interface{}
+	// Err is the underlying error, if any
+	Err error
 }
 
 func (c *CongressError) Error() string {
-	return fmt.Sprintf("%d: %s", c.StatusCode, c.Message)
+	msg := c.Message
+	if c.StatusCode != 0 {
+		msg = fmt.Sprintf("%d: %s", c.StatusCode, c.Message)
+	}
+	if c.Operation == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s %s: %s", c.Operation, c.Path, msg)
+}
+
+// Unwrap returns the underlying error
+func (c *CongressError) Unwrap() error {
+	return c.Err
+}
+
+// Is matches the error against the sentinel errors
+func (c *CongressError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return c.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return c.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return c.StatusCode == http.StatusForbidden
+	case ErrConflict:
+		return c.StatusCode == http.StatusConflict || c.StatusCode == http.StatusPreconditionFailed
+	case ErrRateLimited:
+		return c.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return c.StatusCode >= 500 && c.StatusCode < 600
+	}
+	return false
 }
 
-// Create a new CongressError instance from a response.
-func newCongressError(resp *http.Response) *CongressError {
-	ret := &CongressError{StatusCode: resp.StatusCode}
-	if buf, err := ioutil.ReadAll(resp.Body); err != nil {
+// Create a new CongressError instance from a response. If the body is a
+// JSON object the message is taken from the "message" or "error" field.
+func newCongressError(call *Call, resp *http.Response) *CongressError {
+	ret := &CongressError{
+		StatusCode: resp.StatusCode,
+		Operation:  call.Operation,
+		Path:       call.Request.URL.Path,
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
 		ret.Message = err.Error()
-	} else {
-		ret.Message = string(buf)
+		ret.Err = err
+		return ret
+	}
+	ret.Body = string(buf)
+	ret.Message = ret.Body
+	if err := json.Unmarshal(buf, &ret.Fields); err == nil {
+		for _, name := range []string{"message", "error"} {
+			if msg, ok := ret.Fields[name].(string); ok {
+				ret.Message = msg
+				break
+			}
+		}
 	}
 	return ret
 }
 
+// Wrap an error that isn't returned by Congress, f.e. network errors
+func wrapError(call *Call, err error) error {
+	if _, ok := err.(*CongressError); ok {
+		return err
+	}
+	return &CongressError{
+		Message:   err.Error(),
+		Operation: call.Operation,
+		Path:      call.Request.URL.Path,
+		Err:       err,
+	}
+}
+
 // Convert http response to error
-func responseToError(response *http.Response) error {
+func responseToError(call *Call, response *http.Response) error {
 	if response.StatusCode < 300 {
 		return nil
 	}
-	return newCongressError(response)
+	return newCongressError(call, response)
 }
 
 // ErrorMessage returns the message part of the CongressError error
 func ErrorMessage(err error) string {
-	msg, ok := err.(*CongressError)
-	if ok {
+	var msg *CongressError
+	if errors.As(err, &msg) {
 		return msg.Message
 	}
 	return ""
@@ -69,8 +160,8 @@ func ErrorMessage(err error) string {
 
 // ErrorStatusCode returns the HTTP status code of the CongressError error
 func ErrorStatusCode(err error) int {
-	msg, ok := err.(*CongressError)
-	if ok {
+	var msg *CongressError
+	if errors.As(err, &msg) {
 		return msg.StatusCode
 	}
 	return 0
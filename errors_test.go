@@ -0,0 +1,75 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/applications/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Application not found","id":"missing"}`))
+		case "/applications/broken":
+			w.Write([]byte(`{not json`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("Try again later"))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing())
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+
+	_, err = client.GetApplication("missing")
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrServer) {
+		t.Fatalf("Expected ErrNotFound but got %v", err)
+	}
+	var cerr *CongressError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("Expected CongressError but got %T", err)
+	}
+	if cerr.Operation != "CongressClient.GetApplication" || cerr.Path != "/applications/missing" {
+		t.Fatalf("Operation and path aren't set: %+v", cerr)
+	}
+	if cerr.Message != "Application not found" || cerr.Fields["id"] != "missing" {
+		t.Fatalf("Body isn't parsed: %+v", cerr)
+	}
+
+	if _, err := client.Gateways(); !errors.Is(err, ErrServer) || ErrorMessage(err) != "Try again later" {
+		t.Fatalf("Expected ErrServer but got %v", err)
+	}
+
+	_, err = client.GetApplication("broken")
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) || ErrorStatusCode(err) != 0 {
+		t.Fatalf("Expected wrapped JSON error but got %v", err)
+	}
+
+	if !errors.Is(ErrInvalidPort, ErrInvalidPort) || errors.Is(ErrInvalidPort, ErrNotFound) {
+		t.Fatal("ErrInvalidPort doesn't match correctly")
+	}
+}
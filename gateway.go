@@ -17,6 +17,7 @@ package gocongress
  */
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
@@ -34,6 +35,7 @@ type Gateway struct {
 	Altitude  float32 `json:"altitude,omitempty"`
 	tagResource
 	client *CongressClient
+	rev    entityRevision
 }
 
 // Position represents a geographical position with latitude, longitude and altitude
@@ -45,14 +47,22 @@ type Position struct {
 
 // Update updates the gateway in the Congress backend. The updated gateway is returned.
 func (gw *Gateway) Update() (*Gateway, error) {
-	ret, err := gw.client.genericMutation(http.MethodPut, fmt.Sprintf("/gateways/%s", gw.EUI), gw)
-	if ret == nil {
-		return nil, err
-	}
-	return ret.(*Gateway), err
+	return gw.UpdateContext(context.Background())
+}
+
+// UpdateContext updates the gateway in the Congress backend using the provided
+// context. The updated gateway is returned.
+func (gw *Gateway) UpdateContext(ctx context.Context) (*Gateway, error) {
+	return genericMutation(ctx, gw.client, "Gateway.Update", http.MethodPut, fmt.Sprintf("/gateways/%s", gw.EUI), gw)
 }
 
 // Delete removes the gateway from the Congress backend.
 func (gw *Gateway) Delete() error {
-	return gw.client.genericDelete(fmt.Sprintf("/gateways/%s", gw.EUI))
+	return gw.DeleteContext(context.Background())
+}
+
+// DeleteContext removes the gateway from the Congress backend using the
+// provided context.
+func (gw *Gateway) DeleteContext(ctx context.Context) error {
+	return gw.client.genericDelete(ctx, "Gateway.Delete", fmt.Sprintf("/gateways/%s", gw.EUI))
 }
@@ -0,0 +1,372 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrIncompleteHistory is returned when the messages in a range can't all
+// be retrieved, f.e. because Congress ignores the range parameters and the
+// range reaches further back than maxHistoryLimit messages.
+var ErrIncompleteHistory = errors.New("incomplete message history")
+
+// The most messages requested at once when Congress ignores the since and
+// until parameters
+const maxHistoryLimit = 1 << 16
+
+// MessageRange iterates over the device's upstream messages from since up
+// to, but not including, until. The messages are returned newest first. A
+// zero since or until leaves that end of the range open.
+//
+// The since and until parameters are sent to Congress and the history is
+// paged backwards by moving until to the oldest message returned so far.
+// Messages outside the range are filtered out on the client and duplicates
+// are skipped. If Congress ignores until, or a page is filled by messages
+// with the same timestamp, the newest messages are requested with a growing
+// limit until they reach back to since. The iteration stops with
+// ErrIncompleteHistory if that takes more than maxHistoryLimit messages.
+func (device *Device) MessageRange(ctx context.Context, since, until time.Time) iter.Seq2[UpstreamMessage, error] {
+	return func(yield func(UpstreamMessage, error) bool) {
+		type msgList struct {
+			Msgs []UpstreamMessage `json:"messages"`
+		}
+
+		size := device.client.pageSize
+		if size <= 0 {
+			size = DefaultPageSize
+		}
+		lower, upper := int64(math.MinInt64), int64(math.MaxInt64)
+		params := url.Values{"limit": {strconv.Itoa(size)}}
+		if !since.IsZero() {
+			lower = since.UnixMilli()
+			params.Set("since", strconv.FormatInt(lower, 10))
+		}
+		if !until.IsZero() {
+			upper = until.UnixMilli()
+			params.Set("until", strconv.FormatInt(upper, 10))
+		}
+
+		// The messages returned with the oldest timestamp so far. Anything
+		// newer than that has been returned already. The next page includes
+		// the oldest timestamp since there may be more messages with it.
+		oldest := int64(math.MaxInt64)
+		boundary := make(map[UpstreamMessage]bool)
+		// Yield the messages in the range that haven't been yielded yet.
+		// The messages must be newest first.
+		emit := func(msgs []UpstreamMessage) (progress, done bool) {
+			for _, msg := range msgs {
+				switch {
+				case msg.Timestamp >= upper || msg.Timestamp > oldest:
+					continue
+				case msg.Timestamp < lower:
+					return progress, true
+				case msg.Timestamp < oldest:
+					oldest = msg.Timestamp
+					clear(boundary)
+				case boundary[msg]:
+					continue
+				}
+				boundary[msg] = true
+				progress = true
+				if !yield(msg, nil) {
+					return progress, true
+				}
+			}
+			return progress, false
+		}
+		for {
+			list, err := genericGet(ctx, device.client, "Device.Messages", device.dataPath()+"?"+params.Encode(), &msgList{})
+			if err != nil {
+				yield(UpstreamMessage{}, err)
+				return
+			}
+			progress, done := emit(list.Msgs)
+			if done || len(list.Msgs) < size {
+				return
+			}
+			if !progress {
+				msgs, err := device.messagesBack(ctx, lower, 2*size, nil)
+				if err != nil {
+					yield(UpstreamMessage{}, err)
+					return
+				}
+				emit(msgs)
+				return
+			}
+			params.Set("until", strconv.FormatInt(oldest+1, 10))
+		}
+	}
+}
+
+// MessagesBetween returns the device's upstream messages from since up to,
+// but not including, until, oldest first. See MessageRange for details.
+func (device *Device) MessagesBetween(ctx context.Context, since, until time.Time) ([]UpstreamMessage, error) {
+	var ret []UpstreamMessage
+	for msg, err := range device.MessageRange(ctx, since, until) {
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, msg)
+	}
+	slices.Reverse(ret)
+	return ret, nil
+}
+
+// History iterates over the upstream messages from all of the application's
+// devices from since up to, but not including, until, oldest first. A zero
+// since starts at the beginning of the history and a zero until ends at the
+// current time. The devices' histories are fetched concurrently, with at
+// most DefaultBulkConcurrency requests at a time, and merged by timestamp.
+// Messages seen more than once are skipped.
+//
+// Each device's history is paged forward with the since and until
+// parameters so only one page per device is kept in memory. If Congress
+// ignores the parameters, the rest of the device's range is fetched with a
+// growing limit like MessageRange does, and filtered and sorted on the
+// client. The iteration stops at the first error.
+func (app *Application) History(ctx context.Context, since, until time.Time) iter.Seq2[UpstreamMessage, error] {
+	return func(yield func(UpstreamMessage, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		defer cancel()
+
+		lower, upper := int64(0), time.Now().UnixMilli()
+		if !since.IsZero() {
+			lower = since.UnixMilli()
+		}
+		if !until.IsZero() {
+			upper = until.UnixMilli()
+		}
+		requests := make(chan struct{}, DefaultBulkConcurrency)
+
+		var channels []chan historyItem
+		for device, err := range app.AllDevices(ctx) {
+			if err != nil {
+				yield(UpstreamMessage{}, err)
+				return
+			}
+			ch := make(chan historyItem)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer close(ch)
+				for msg, err := range device.messagesForward(ctx, lower, upper, requests) {
+					select {
+					case ch <- historyItem{msg, err, ch}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			channels = append(channels, ch)
+		}
+
+		// Wait for the first message from each device
+		var heads historyHeap
+		for _, ch := range channels {
+			if item, ok := <-ch; ok {
+				heads = append(heads, item)
+			}
+		}
+		heap.Init(&heads)
+
+		// The messages returned with the current timestamp
+		current := int64(math.MinInt64)
+		boundary := make(map[UpstreamMessage]bool)
+		for len(heads) > 0 {
+			item := heap.Pop(&heads).(historyItem)
+			if item.err != nil {
+				yield(UpstreamMessage{}, item.err)
+				return
+			}
+			if item.msg.Timestamp > current {
+				current = item.msg.Timestamp
+				clear(boundary)
+			}
+			if !boundary[item.msg] {
+				boundary[item.msg] = true
+				if !yield(item.msg, nil) {
+					return
+				}
+			}
+			if next, ok := <-item.ch; ok {
+				heap.Push(&heads, next)
+			}
+		}
+	}
+}
+
+// Iterate over the device's messages from lower up to, but not including,
+// upper, oldest first. The range is split into windows with less than a
+// page of messages; the window shrinks when a page is full and grows when
+// it isn't. If Congress ignores the range the rest of it is fetched with
+// messagesBack. A slot in requests is held while a page is fetched.
+func (device *Device) messagesForward(ctx context.Context, lower, upper int64, requests chan struct{}) iter.Seq2[UpstreamMessage, error] {
+	return func(yield func(UpstreamMessage, error) bool) {
+		type msgList struct {
+			Msgs []UpstreamMessage `json:"messages"`
+		}
+
+		size := device.client.pageSize
+		if size <= 0 {
+			size = DefaultPageSize
+		}
+		window := upper - lower
+		for lower < upper {
+			end := lower + window
+			params := url.Values{
+				"limit": {strconv.Itoa(size)},
+				"since": {strconv.FormatInt(lower, 10)},
+				"until": {strconv.FormatInt(end, 10)},
+			}
+			select {
+			case requests <- struct{}{}:
+			case <-ctx.Done():
+				yield(UpstreamMessage{}, context.Cause(ctx))
+				return
+			}
+			list, err := genericGet(ctx, device.client, "Device.Messages", device.dataPath()+"?"+params.Encode(), &msgList{})
+			<-requests
+			if err != nil {
+				yield(UpstreamMessage{}, err)
+				return
+			}
+			msgs := list.Msgs
+			ignored := slices.ContainsFunc(msgs, func(msg UpstreamMessage) bool {
+				return msg.Timestamp < lower || msg.Timestamp >= end
+			})
+			switch {
+			case ignored || (len(msgs) >= size && end-lower <= 1):
+				// The rest of the range is fetched without the parameters
+				if msgs, err = device.messagesBack(ctx, lower, 2*size, requests); err != nil {
+					yield(UpstreamMessage{}, err)
+					return
+				}
+				msgs = slices.DeleteFunc(msgs, func(msg UpstreamMessage) bool {
+					return msg.Timestamp < lower || msg.Timestamp >= upper
+				})
+				end = upper
+			case len(msgs) >= size:
+				window = (end - lower) / 2
+				continue
+			}
+			slices.SortStableFunc(msgs, func(a, b UpstreamMessage) int {
+				return cmp.Compare(a.Timestamp, b.Timestamp)
+			})
+			for _, msg := range msgs {
+				if !yield(msg, nil) {
+					return
+				}
+			}
+			lower = end
+			if window <= (upper-lower)/2 {
+				window *= 2
+			} else {
+				window = upper - lower
+			}
+		}
+	}
+}
+
+// Fetch the device's newest messages without the range parameters. The
+// limit is doubled until the messages reach back before lower or there are
+// no more, and the messages are returned newest first. If requests is set a
+// slot is held while a page is fetched.
+func (device *Device) messagesBack(ctx context.Context, lower int64, limit int, requests chan struct{}) ([]UpstreamMessage, error) {
+	type msgList struct {
+		Msgs []UpstreamMessage `json:"messages"`
+	}
+	for {
+		limit = min(limit, maxHistoryLimit)
+		if requests != nil {
+			select {
+			case requests <- struct{}{}:
+			case <-ctx.Done():
+				return nil, context.Cause(ctx)
+			}
+		}
+		list, err := genericGet(ctx, device.client, "Device.Messages", fmt.Sprintf("%s?limit=%d", device.dataPath(), limit), &msgList{})
+		if requests != nil {
+			<-requests
+		}
+		if err != nil {
+			return nil, err
+		}
+		msgs := list.Msgs
+		slices.SortStableFunc(msgs, func(a, b UpstreamMessage) int {
+			return cmp.Compare(b.Timestamp, a.Timestamp)
+		})
+		if len(msgs) < limit || (len(msgs) > 0 && msgs[len(msgs)-1].Timestamp < lower) {
+			return msgs, nil
+		}
+		if limit >= maxHistoryLimit {
+			return nil, &CongressError{Message: fmt.Sprintf("the range has more than %d messages", maxHistoryLimit), Operation: "Device.Messages", Path: device.dataPath(), Err: ErrIncompleteHistory}
+		}
+		limit *= 2
+	}
+}
+
+// Path to the device's message history
+func (device *Device) dataPath() string {
+	return fmt.Sprintf("/applications/%s/devices/%s/data", device.app.EUI, device.EUI)
+}
+
+// The next message from one of the devices in History
+type historyItem struct {
+	msg UpstreamMessage
+	err error
+	ch  chan historyItem
+}
+
+// Heap with the oldest message first. Errors come before anything else.
+type historyHeap []historyItem
+
+func (h historyHeap) Len() int { return len(h) }
+
+func (h historyHeap) Less(i, j int) bool {
+	if h[i].err != nil || h[j].err != nil {
+		return h[i].err != nil
+	}
+	if h[i].msg.Timestamp != h[j].msg.Timestamp {
+		return h[i].msg.Timestamp < h[j].msg.Timestamp
+	}
+	return h[i].msg.DeviceEUI < h[j].msg.DeviceEUI
+}
+
+func (h historyHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *historyHeap) Push(x interface{}) { *h = append(*h, x.(historyItem)) }
+
+func (h *historyHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,372 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gregersrygg/gocongress/congresstest"
+)
+
+// Collect the timestamps of the messages in seconds
+func timestamps(msgs []UpstreamMessage) []int64 {
+	ret := make([]int64, len(msgs))
+	for i, msg := range msgs {
+		ret[i] = msg.Timestamp / 1000
+	}
+	return ret
+}
+
+func TestMessagesBetween(t *testing.T) {
+	server := congresstest.NewServer("", congresstest.WithPaging())
+	defer server.Close()
+	client, err := NewCongressClient("", WithAddr(server.URL), WithPageSize(3))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	device, err := app.NewDevice(OTAA)
+	if err != nil {
+		t.Fatalf("Got error creating device: %v", err)
+	}
+	for i := 30; i > 0; i-- {
+		server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{Timestamp: int64(i) * 1000})
+	}
+
+	msgs, err := device.MessagesBetween(context.Background(), time.UnixMilli(5000), time.UnixMilli(12000))
+	if err != nil {
+		t.Fatalf("Got error retrieving messages: %v", err)
+	}
+	if got := timestamps(msgs); len(got) != 7 || got[0] != 5 || got[6] != 11 {
+		t.Fatalf("Unexpected messages: %v", got)
+	}
+
+	msgs, err = device.MessagesBetween(context.Background(), time.UnixMilli(28000), time.Time{})
+	if got := timestamps(msgs); err != nil || len(got) != 3 || got[0] != 28 || got[2] != 30 {
+		t.Fatalf("Unexpected messages with open end: %v (%v)", got, err)
+	}
+}
+
+func TestMessageRangeClientSide(t *testing.T) {
+	// The server ignores since, and a new message arrives before each page.
+	// There are several messages at 12s so they are split across pages.
+	var mutex sync.Mutex
+	history := []UpstreamMessage{}
+	for i := 20; i > 0; i-- {
+		history = append(history, UpstreamMessage{Timestamp: int64(i) * 1000})
+		if i == 12 {
+			for _, data := range []string{"01", "02"} {
+				history = append(history, UpstreamMessage{Timestamp: 12000, StringData: data})
+			}
+		}
+	}
+	next := int64(21)
+	ignoreUntil := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		history = append([]UpstreamMessage{{Timestamp: next * 1000}}, history...)
+		next++
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		until, err := strconv.ParseInt(r.URL.Query().Get("until"), 10, 64)
+		if err != nil || ignoreUntil {
+			until = math.MaxInt64
+		}
+		page := []UpstreamMessage{}
+		for _, msg := range history {
+			if msg.Timestamp < until && len(page) < limit {
+				page = append(page, msg)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"messages": page})
+	}))
+	defer server.Close()
+
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithPageSize(4))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	device := client.device("00-01", "00-02")
+	// The limit grows on the client if until is ignored
+	for _, ignore := range []bool{false, true} {
+		mutex.Lock()
+		ignoreUntil = ignore
+		mutex.Unlock()
+		msgs, err := device.MessagesBetween(context.Background(), time.UnixMilli(3000), time.UnixMilli(15000))
+		if err != nil {
+			t.Fatalf("Got error retrieving messages: %v", err)
+		}
+		got := timestamps(msgs)
+		if len(got) != 14 || got[0] != 3 || got[13] != 14 {
+			t.Fatalf("Expected 14 messages from 3s to 14s when ignoring until is %v but got %v", ignore, got)
+		}
+		seen := make(map[UpstreamMessage]bool)
+		for i, msg := range msgs {
+			if seen[msg] || (i > 0 && got[i] < got[i-1]) {
+				t.Fatalf("Messages aren't ordered and unique: %v", got)
+			}
+			seen[msg] = true
+		}
+	}
+}
+
+func TestMessageRangeUnsupported(t *testing.T) {
+	// The server only honours the limit
+	server := congresstest.NewServer("")
+	defer server.Close()
+	client, err := NewCongressClient("", WithAddr(server.URL), WithPageSize(3))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	device, err := app.NewDevice(OTAA)
+	if err != nil {
+		t.Fatalf("Got error creating device: %v", err)
+	}
+	for i := 30; i > 0; i-- {
+		server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{Timestamp: int64(i) * 1000})
+	}
+
+	// The limit grows until the messages reach back to since
+	msgs, err := device.MessagesBetween(context.Background(), time.UnixMilli(5000), time.UnixMilli(12000))
+	if got := timestamps(msgs); err != nil || len(got) != 7 || got[0] != 5 || got[6] != 11 {
+		t.Fatalf("Unexpected messages: %v (%v)", got, err)
+	}
+	// The newest messages are in the first page
+	msgs, err = device.MessagesBetween(context.Background(), time.UnixMilli(28001), time.Time{})
+	if got := timestamps(msgs); err != nil || len(got) != 2 || got[0] != 29 {
+		t.Fatalf("Expected the two newest messages but got %v (%v)", got, err)
+	}
+}
+
+func TestMessageRangeIncomplete(t *testing.T) {
+	// The server ignores since and until and always has more messages
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		page := make([]UpstreamMessage, limit)
+		for i := range page {
+			page[i] = UpstreamMessage{Timestamp: 10000, StringData: strconv.Itoa(i)}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"messages": page})
+	}))
+	defer server.Close()
+
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithPageSize(1024))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	device := client.device("00-01", "00-02")
+	if _, err := device.MessagesBetween(context.Background(), time.UnixMilli(5000), time.Time{}); !errors.Is(err, ErrIncompleteHistory) {
+		t.Fatalf("Expected incomplete history but got %v", err)
+	}
+	if n := requests.Load(); n > 10 {
+		t.Fatalf("Expected the limit to stop growing but got %d requests", n)
+	}
+}
+
+func TestApplicationHistory(t *testing.T) {
+	server := congresstest.NewServer("", congresstest.WithPaging())
+	defer server.Close()
+	client, err := NewCongressClient("", WithAddr(server.URL), WithPageSize(2))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		device, err := app.NewDevice(ABP)
+		if err != nil {
+			t.Fatalf("Got error creating device: %v", err)
+		}
+		for ts := 20 - i; ts > 0; ts -= 3 {
+			server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{Timestamp: int64(ts) * 1000})
+		}
+		// All devices send one message at the same time
+		server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{Timestamp: 30000})
+	}
+
+	var msgs []UpstreamMessage
+	for msg, err := range app.History(context.Background(), time.UnixMilli(4000), time.UnixMilli(31000)) {
+		if err != nil {
+			t.Fatalf("Got error retrieving history: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	got := timestamps(msgs)
+	if len(got) != 20 || got[0] != 4 || got[16] != 20 || got[17] != 30 || got[19] != 30 {
+		t.Fatalf("Unexpected history: %v", got)
+	}
+	for i := 1; i < 17; i++ {
+		if got[i] != got[i-1]+1 {
+			t.Fatalf("History isn't ordered: %v", got)
+		}
+	}
+	if msgs[17].DeviceEUI == msgs[18].DeviceEUI || msgs[18].DeviceEUI == msgs[19].DeviceEUI {
+		t.Fatal("Messages with the same timestamp from different devices were merged")
+	}
+
+	// Stopping early
+	n := 0
+	for range app.History(context.Background(), time.Time{}, time.Time{}) {
+		if n++; n == 5 {
+			break
+		}
+	}
+
+	server.AddFault(congresstest.Fault{Path: "/applications/*/devices/*/data", StatusCode: http.StatusInternalServerError})
+	for _, err := range app.History(context.Background(), time.Time{}, time.Time{}) {
+		if err == nil {
+			t.Fatal("Expected error when the history can't be retrieved")
+		}
+	}
+}
+
+func TestApplicationHistoryConcurrency(t *testing.T) {
+	server := congresstest.NewServer("", congresstest.WithPaging())
+	defer server.Close()
+	var current, highest atomic.Int32
+	client, err := NewCongressClient("", WithAddr(server.URL), WithMiddleware(inFlight(&current, &highest)))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	for i := 0; i < 3*DefaultBulkConcurrency; i++ {
+		device, err := app.NewDevice(ABP)
+		if err != nil {
+			t.Fatalf("Got error creating device: %v", err)
+		}
+		server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{Timestamp: int64(i+1) * 1000})
+	}
+	server.AddFault(congresstest.Fault{Path: "/applications/*/devices/*/data", Latency: 5 * time.Millisecond})
+
+	n := 0
+	for _, err := range app.History(context.Background(), time.Time{}, time.UnixMilli(100000)) {
+		if err != nil {
+			t.Fatalf("Got error retrieving history: %v", err)
+		}
+		n++
+	}
+	if n != 3*DefaultBulkConcurrency {
+		t.Fatalf("Expected %d messages but got %d", 3*DefaultBulkConcurrency, n)
+	}
+	if highest.Load() > DefaultBulkConcurrency {
+		t.Fatalf("Expected at most %d requests in flight but got %d", DefaultBulkConcurrency, highest.Load())
+	}
+}
+
+func TestApplicationHistoryDuplicates(t *testing.T) {
+	// The server returns the same messages for both devices
+	history := []UpstreamMessage{
+		{Timestamp: 3000, DeviceEUI: "00-02"}, {Timestamp: 2000, DeviceEUI: "00-02"}, {Timestamp: 1000, DeviceEUI: "00-02"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/applications/00-01/devices" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"devices": []Device{{EUI: "00-02"}, {EUI: "00-03"}}})
+			return
+		}
+		since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		until, _ := strconv.ParseInt(r.URL.Query().Get("until"), 10, 64)
+		ret := []UpstreamMessage{}
+		for _, msg := range history {
+			if msg.Timestamp >= since && msg.Timestamp < until {
+				ret = append(ret, msg)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"messages": ret})
+	}))
+	defer server.Close()
+
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing())
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	var msgs []UpstreamMessage
+	for msg, err := range client.application("00-01").History(context.Background(), time.Time{}, time.Time{}) {
+		if err != nil {
+			t.Fatalf("Got error retrieving history: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if got := timestamps(msgs); len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Fatalf("Expected duplicates to be skipped but got %v", got)
+	}
+}
+
+func TestApplicationHistoryUnsupported(t *testing.T) {
+	// The server ignores since and until
+	server := congresstest.NewServer("")
+	defer server.Close()
+	client, err := NewCongressClient("", WithAddr(server.URL), WithPageSize(3))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		device, err := app.NewDevice(ABP)
+		if err != nil {
+			t.Fatalf("Got error creating device: %v", err)
+		}
+		for ts := 2*i + 1; ts <= 20; ts += 4 {
+			server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{Timestamp: int64(ts) * 1000})
+			server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{Timestamp: int64(ts+1) * 1000})
+		}
+	}
+
+	// The devices' histories are filtered and sorted on the client
+	var msgs []UpstreamMessage
+	for msg, err := range app.History(context.Background(), time.UnixMilli(3000), time.UnixMilli(15000)) {
+		if err != nil {
+			t.Fatalf("Got error retrieving history: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	got := timestamps(msgs)
+	if len(got) != 12 || got[0] != 3 || got[11] != 14 {
+		t.Fatalf("Expected 12 messages from 3s to 14s but got %v", got)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] != got[i-1]+1 {
+			t.Fatalf("History isn't ordered: %v", got)
+		}
+	}
+}
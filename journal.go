@@ -0,0 +1,388 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// The header with the idempotency key for journaled operations
+const idempotencyHeader = "Idempotency-Key"
+
+// ErrJournaled matches errors for mutations that were written to the journal
+// instead of being applied.
+var ErrJournaled = errors.New("mutation journaled")
+
+// The operations that are written to the journal
+var journaledOperations = map[string]bool{
+	"Application.Update":    true,
+	"Application.NewDevice": true,
+	"Device.Update":         true,
+	"Device.EnqueueMessage": true,
+	"Gateway.Update":        true,
+}
+
+// JournalEntry is a mutation in the journal.
+type JournalEntry struct {
+	// ID is the idempotency key of the mutation. It is sent to Congress in
+	// the Idempotency-Key header every time the mutation is attempted.
+	ID        string          `json:"id"`
+	Time      time.Time       `json:"time"`
+	Operation string          `json:"operation"`
+	Method    string          `json:"method"`
+	Path      string          `json:"path"`
+	Body      json.RawMessage `json:"body,omitempty"`
+}
+
+// JournalError is returned for mutations that were written to the journal.
+// Err is the error from the failed attempt; it is nil for deferred mutations.
+type JournalError struct {
+	Entry JournalEntry
+	Err   error
+}
+
+func (j *JournalError) Error() string {
+	if j.Err == nil {
+		return fmt.Sprintf("%s deferred to journal as %s", j.Entry.Operation, j.Entry.ID)
+	}
+	return fmt.Sprintf("%s written to journal as %s: %v", j.Entry.Operation, j.Entry.ID, j.Err)
+}
+
+// Unwrap returns the error from the failed attempt
+func (j *JournalError) Unwrap() error {
+	return j.Err
+}
+
+// Is matches ErrJournaled
+func (j *JournalError) Is(target error) bool {
+	return target == ErrJournaled
+}
+
+// Records in the journal file. Mutations are added with the "mutation" type
+// and resolved with the "applied" or "conflict" type.
+type journalRecord struct {
+	Type  string `json:"type"`
+	Error string `json:"error,omitempty"`
+	JournalEntry
+}
+
+// Journal is an append-only file with mutations that couldn't be sent to
+// Congress. Calls to Application.Update, Application.NewDevice,
+// Device.Update, Device.EnqueueMessage and Gateway.Update that fail without
+// getting a response from Congress are written to the journal when the
+// client has one, and ReplayJournal applies them later.
+// The journal file contains device keys and is created with mode 0600.
+type Journal struct {
+	mutex   sync.Mutex
+	file    *os.File
+	pending []JournalEntry
+	// Held while the journal is replayed so entries aren't sent twice
+	replaying sync.Mutex
+}
+
+// OpenJournal opens or creates the journal file. Existing entries that
+// haven't been resolved are pending.
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{file: file}
+	if err := j.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// Read the records in the file
+func (j *Journal) load() error {
+	resolved := make(map[string]bool)
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(j.file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("corrupt journal record: %v", err)
+		}
+		switch rec.Type {
+		case "mutation":
+			entries = append(entries, rec.JournalEntry)
+		default:
+			resolved[rec.ID] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !resolved[entry.ID] {
+			j.pending = append(j.pending, entry)
+		}
+	}
+	_, err := j.file.Seek(0, io.SeekEnd)
+	return err
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.file.Close()
+}
+
+// Pending returns the mutations that haven't been applied yet, in order.
+func (j *Journal) Pending() []JournalEntry {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return append([]JournalEntry(nil), j.pending...)
+}
+
+// Add a mutation to the journal
+func (j *Journal) add(entry JournalEntry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if err := j.write(journalRecord{Type: "mutation", JournalEntry: entry}); err != nil {
+		return err
+	}
+	j.pending = append(j.pending, entry)
+	return nil
+}
+
+// Mark a mutation as resolved
+func (j *Journal) resolve(entry JournalEntry, recType string, cause error) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	rec := journalRecord{Type: recType, JournalEntry: JournalEntry{ID: entry.ID, Time: time.Now()}}
+	if cause != nil {
+		rec.Error = cause.Error()
+	}
+	if err := j.write(rec); err != nil {
+		return err
+	}
+	for i := range j.pending {
+		if j.pending[i].ID == entry.ID {
+			j.pending = append(j.pending[:i], j.pending[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Write a record and sync the file. The mutex must be held.
+func (j *Journal) write(rec journalRecord) error {
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(buf, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// WithJournal makes the client write failed mutations to the journal.
+func WithJournal(journal *Journal) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.journal = journal
+	}
+}
+
+type deferKey struct{}
+
+type replayKey struct{}
+
+// DeferMutation returns a context that makes journaled operations go
+// straight to the journal without being sent to Congress. The client must
+// have a journal.
+func DeferMutation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deferKey{}, true)
+}
+
+// Middleware that writes failed and deferred mutations to the journal
+func (c *CongressClient) journalCalls(next Handler) Handler {
+	return func(call *Call) error {
+		ctx := call.Request.Context()
+		if !journaledOperations[call.Operation] || ctx.Value(replayKey{}) != nil {
+			return next(call)
+		}
+		entry, err := newJournalEntry(call)
+		if err != nil {
+			return err
+		}
+		call.Request.Header.Set(idempotencyHeader, entry.ID)
+
+		if deferred, _ := ctx.Value(deferKey{}).(bool); deferred {
+			if err := c.journal.add(entry); err != nil {
+				return err
+			}
+			return &JournalError{Entry: entry}
+		}
+
+		// Only journal the mutation if no response was received. Congress
+		// may have applied it otherwise, f.e. when the response couldn't
+		// be decoded or there was a server error.
+		err = next(call)
+		if err == nil || call.Response != nil || !isConnectivityError(ctx, err) {
+			return err
+		}
+		if jerr := c.journal.add(entry); jerr != nil {
+			return err
+		}
+		return &JournalError{Entry: entry, Err: err}
+	}
+}
+
+// Create a journal entry for a call
+func newJournalEntry(call *Call) (JournalEntry, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return JournalEntry{}, err
+	}
+	entry := JournalEntry{
+		ID:        hex.EncodeToString(id),
+		Time:      time.Now(),
+		Operation: call.Operation,
+		Method:    call.Request.Method,
+		Path:      call.Request.URL.Path,
+	}
+	if call.Request.URL.RawQuery != "" {
+		entry.Path += "?" + call.Request.URL.RawQuery
+	}
+	if call.Request.GetBody != nil {
+		body, err := call.Request.GetBody()
+		if err != nil {
+			return JournalEntry{}, err
+		}
+		defer body.Close()
+		buf, err := io.ReadAll(body)
+		if err != nil {
+			return JournalEntry{}, err
+		}
+		if len(buf) > 0 {
+			entry.Body = json.RawMessage(buf)
+		}
+	}
+	return entry, nil
+}
+
+// Check if an error means Congress couldn't be reached or couldn't handle
+// the request right now
+func isConnectivityError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, ErrServer) || errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	return ErrorStatusCode(err) == 0
+}
+
+// Check if Congress rejected a replayed mutation. Authentication errors
+// aren't conflicts since the mutation may succeed with a valid token.
+func isReplayConflict(err error) bool {
+	if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) || errors.Is(err, ErrRateLimited) {
+		return false
+	}
+	status := ErrorStatusCode(err)
+	return status >= 400 && status < 500
+}
+
+// ReplayConflict is a journaled mutation that Congress rejected during replay.
+type ReplayConflict struct {
+	Entry JournalEntry
+	Err   error
+}
+
+// ReplayReport is the result of ReplayJournal.
+type ReplayReport struct {
+	// Applied is the list of mutations that were applied
+	Applied []JournalEntry
+	// Conflicts is the list of mutations that Congress rejected. They are
+	// removed from the journal.
+	Conflicts []ReplayConflict
+	// Pending is the number of mutations left in the journal
+	Pending int
+}
+
+// ReplayJournal applies the pending mutations in the journal in order.
+// Mutations that Congress rejects with a 4xx status are reported as
+// conflicts and removed from the journal. The replay stops at the first
+// mutation that fails for any other reason, f.e. because Congress can't be
+// reached or the token is rejected with a 401 or 403 status; that mutation
+// and the ones after it stay in the journal and the error is returned.
+// Concurrent replays of the same journal run one at a time.
+func (c *CongressClient) ReplayJournal(ctx context.Context) (*ReplayReport, error) {
+	if c.journal == nil {
+		return nil, errors.New("client has no journal")
+	}
+	c.journal.replaying.Lock()
+	defer c.journal.replaying.Unlock()
+	report := &ReplayReport{}
+	defer func() {
+		report.Pending = len(c.journal.Pending())
+	}()
+	replayCtx := context.WithValue(ctx, replayKey{}, true)
+	for _, entry := range c.journal.Pending() {
+		err := c.replay(replayCtx, entry)
+		switch {
+		case err == nil:
+			if err := c.journal.resolve(entry, "applied", nil); err != nil {
+				return report, err
+			}
+			report.Applied = append(report.Applied, entry)
+		case isReplayConflict(err) && ctx.Err() == nil:
+			if err := c.journal.resolve(entry, "conflict", err); err != nil {
+				return report, err
+			}
+			report.Conflicts = append(report.Conflicts, ReplayConflict{Entry: entry, Err: err})
+		default:
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// Send a journaled mutation
+func (c *CongressClient) replay(ctx context.Context, entry JournalEntry) error {
+	var body interface{}
+	if len(entry.Body) > 0 {
+		body = entry.Body
+	}
+	req, err := c.newRequest(ctx, entry.Path, body)
+	if err != nil {
+		return err
+	}
+	req.Method = entry.Method
+	req.Header.Set(idempotencyHeader, entry.ID)
+	_, err = c.doRequest(entry.Operation, req, nil)
+	return err
+}
@@ -0,0 +1,237 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	mutex := sync.Mutex{}
+	state := "offline"
+	keys := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch state {
+		case "offline":
+			panic(http.ErrAbortHandler)
+		case "unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		case "garbage":
+			w.Write([]byte(`{"deviceEUI":`))
+			return
+		}
+		keys[r.Header.Get(idempotencyHeader)]++
+		if r.URL.Path == "/gateways/gone" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	name := filepath.Join(t.TempDir(), "journal")
+	journal, err := OpenJournal(name)
+	if err != nil {
+		t.Fatalf("Couldn't open journal: %v", err)
+	}
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithJournal(journal))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+
+	app := &Application{EUI: "00-01", client: client}
+	device := &Device{EUI: "00-02", tagResource: newTags(), client: client, app: app}
+	device.SetTag("name", "journaled")
+	if _, err := device.Update(); !errors.Is(err, ErrJournaled) {
+		t.Fatalf("Expected journaled error but got %v", err)
+	}
+	gw := &Gateway{EUI: "gone", client: client}
+	if _, err := gw.UpdateContext(DeferMutation(context.Background())); !errors.Is(err, ErrJournaled) {
+		t.Fatalf("Expected deferred mutation but got %v", err)
+	}
+	// Reads and deletes aren't journaled
+	if _, err := app.Devices(); errors.Is(err, ErrJournaled) {
+		t.Fatal("Read was journaled")
+	}
+	// Congress may have applied mutations that got a response
+	for _, s := range []string{"unavailable", "garbage"} {
+		mutex.Lock()
+		state = s
+		mutex.Unlock()
+		if _, err := device.Update(); err == nil || errors.Is(err, ErrJournaled) {
+			t.Fatalf("Expected unjournaled error when %s but got %v", s, err)
+		}
+	}
+	mutex.Lock()
+	state = "offline"
+	mutex.Unlock()
+	journal.Close()
+
+	// Reopen the journal; both mutations should be pending
+	if journal, err = OpenJournal(name); err != nil {
+		t.Fatalf("Couldn't reopen journal: %v", err)
+	}
+	defer journal.Close()
+	client, _ = NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithJournal(journal))
+	pending := journal.Pending()
+	if len(pending) != 2 || pending[0].Operation != "Device.Update" || pending[1].Operation != "Gateway.Update" {
+		t.Fatalf("Unexpected pending entries: %+v", pending)
+	}
+
+	// Replay fails while Congress is down
+	if report, err := client.ReplayJournal(context.Background()); err == nil || report.Pending != 2 {
+		t.Fatalf("Expected replay to fail but got %v (%+v)", err, report)
+	}
+
+	mutex.Lock()
+	state = "online"
+	mutex.Unlock()
+	report, err := client.ReplayJournal(context.Background())
+	if err != nil {
+		t.Fatalf("Got error replaying journal: %v", err)
+	}
+	if len(report.Applied) != 1 || len(report.Conflicts) != 1 || report.Pending != 0 {
+		t.Fatalf("Unexpected replay report: %+v", report)
+	}
+	if !errors.Is(report.Conflicts[0].Err, ErrNotFound) {
+		t.Fatalf("Expected conflict to be not found but got %v", report.Conflicts[0].Err)
+	}
+	if keys[pending[0].ID] != 1 {
+		t.Fatalf("Idempotency key wasn't sent: %v", keys)
+	}
+
+	// Nothing is applied twice
+	if report, err := client.ReplayJournal(context.Background()); err != nil || len(report.Applied) != 0 {
+		t.Fatalf("Expected empty replay but got %+v (%v)", report, err)
+	}
+}
+
+func TestConcurrentReplay(t *testing.T) {
+	mutex := sync.Mutex{}
+	offline := true
+	keys := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if offline {
+			panic(http.ErrAbortHandler)
+		}
+		keys[r.Header.Get(idempotencyHeader)]++
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatalf("Couldn't open journal: %v", err)
+	}
+	defer journal.Close()
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithJournal(journal))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		gw := &Gateway{EUI: fmt.Sprintf("00-%02d", i), client: client}
+		if _, err := gw.UpdateContext(DeferMutation(context.Background())); !errors.Is(err, ErrJournaled) {
+			t.Fatalf("Expected deferred mutation but got %v", err)
+		}
+	}
+
+	mutex.Lock()
+	offline = false
+	mutex.Unlock()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.ReplayJournal(context.Background()); err != nil {
+				t.Errorf("Got error replaying journal: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(keys) != 20 {
+		t.Fatalf("Expected 20 mutations but got %d", len(keys))
+	}
+	for id, n := range keys {
+		if n != 1 {
+			t.Fatalf("Mutation %s was sent %d times", id, n)
+		}
+	}
+}
+
+func TestReplayUnauthorized(t *testing.T) {
+	mutex := sync.Mutex{}
+	status := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if status == 0 {
+			panic(http.ErrAbortHandler)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatalf("Couldn't open journal: %v", err)
+	}
+	defer journal.Close()
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithJournal(journal))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		gw := &Gateway{EUI: fmt.Sprintf("00-%02d", i), client: client}
+		if _, err := gw.UpdateContext(DeferMutation(context.Background())); !errors.Is(err, ErrJournaled) {
+			t.Fatalf("Expected deferred mutation but got %v", err)
+		}
+	}
+
+	for code, sentinel := range map[int]error{http.StatusUnauthorized: ErrUnauthorized, http.StatusForbidden: ErrForbidden} {
+		mutex.Lock()
+		status = code
+		mutex.Unlock()
+		report, err := client.ReplayJournal(context.Background())
+		if !errors.Is(err, sentinel) {
+			t.Fatalf("Expected %v but got %v", sentinel, err)
+		}
+		if len(report.Conflicts) != 0 || report.Pending != 3 {
+			t.Fatalf("Expected the entries to stay pending after %d but got %+v", code, report)
+		}
+	}
+
+	mutex.Lock()
+	status = http.StatusOK
+	mutex.Unlock()
+	if report, err := client.ReplayJournal(context.Background()); err != nil || len(report.Applied) != 3 || report.Pending != 0 {
+		t.Fatalf("Expected the entries to be applied but got %+v (%v)", report, err)
+	}
+}
@@ -0,0 +1,222 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Redacted replaces secrets in log output
+const Redacted = "[REDACTED]"
+
+// JSON fields that hold secrets. The names are compared in lower case.
+var secretFields = map[string]bool{
+	"appkey":   true,
+	"appskey":  true,
+	"nwkskey":  true,
+	"password": true,
+}
+
+// Headers that hold credentials. Headers with a name containing one of
+// secretHeaderWords are redacted as well. The names are compared in lower
+// case.
+var secretHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+var secretHeaderWords = []string{"token", "secret", "key", "auth", "password", "session"}
+
+// WithLogger makes the client log every API call to the logger. Successful
+// calls are logged at info level and failed calls at warning level. Headers
+// and request bodies are logged at debug level. The API token, credential
+// headers such as Authorization and Cookie and device keys are always
+// redacted.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.logger = logger
+	}
+}
+
+// Middleware that logs the call once it is done
+func (c *CongressClient) logCalls(next Handler) Handler {
+	return func(call *Call) error {
+		start := time.Now()
+		err := next(call)
+
+		ctx := call.Request.Context()
+		attrs := []slog.Attr{
+			slog.String("operation", call.Operation),
+			slog.String("method", call.Request.Method),
+			slog.String("path", call.Request.URL.Path),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if call.Attempts > 1 {
+			attrs = append(attrs, slog.Int("retries", call.Attempts-1))
+		}
+		if call.Response != nil {
+			attrs = append(attrs, slog.Int("status", call.Response.StatusCode))
+		}
+		if c.logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, slog.Any("headers", redactHeader(call.Request.Header)))
+			if body := requestBody(call.Request); body != nil {
+				attrs = append(attrs, slog.String("body", string(body)))
+			}
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+			c.logger.LogAttrs(ctx, slog.LevelWarn, "Congress API call failed", attrs...)
+			return err
+		}
+		c.logger.LogAttrs(ctx, slog.LevelInfo, "Congress API call", attrs...)
+		return nil
+	}
+}
+
+// Return a copy of the header with the API token and other credentials
+// redacted
+func redactHeader(header http.Header) http.Header {
+	ret := header.Clone()
+	for name, values := range ret {
+		if !secretHeader(name) {
+			continue
+		}
+		for i := range values {
+			values[i] = Redacted
+		}
+	}
+	return ret
+}
+
+// Check if the header might hold a credential
+func secretHeader(name string) bool {
+	name = strings.ToLower(name)
+	if secretHeaders[name] {
+		return true
+	}
+	for _, word := range secretHeaderWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Read a redacted copy of the request body. The body is only available if
+// the request can be replayed.
+func requestBody(req *http.Request) []byte {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+	buf, err := io.ReadAll(body)
+	if err != nil || len(buf) == 0 {
+		return nil
+	}
+	return redactJSON(buf)
+}
+
+// Redact secret fields in a JSON document. Documents that can't be parsed
+// are redacted completely.
+func redactJSON(buf []byte) []byte {
+	var doc interface{}
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return []byte(Redacted)
+	}
+	ret, err := json.Marshal(redactValue(doc))
+	if err != nil {
+		return []byte(Redacted)
+	}
+	return ret
+}
+
+// Walk a decoded JSON value and replace secret fields
+func redactValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(v))
+		for key, field := range v {
+			if secretFields[strings.ToLower(key)] {
+				ret[key] = redactString(field)
+				continue
+			}
+			ret[key] = redactValue(field)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for i := range v {
+			ret[i] = redactValue(v[i])
+		}
+		return ret
+	default:
+		return val
+	}
+}
+
+// Redact a secret value. Empty values are kept as is since they don't
+// reveal anything.
+func redactString(val interface{}) interface{} {
+	if s, ok := val.(string); ok && s == "" {
+		return s
+	}
+	return Redacted
+}
+
+// LogValue implements slog.LogValuer. The device keys are redacted.
+func (device Device) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("deviceEUI", device.EUI),
+		slog.String("devAddr", device.DeviceAddress),
+		slog.Any("appKey", redactString(device.ApplicationKey)),
+		slog.Any("appSKey", redactString(device.ApplicationSessionKey)),
+		slog.Any("nwkSKey", redactString(device.NetworkSessionKey)),
+		slog.Int("fCntUp", int(device.FrameCounterUp)),
+		slog.Int("fCntDn", int(device.FrameCounterDown)),
+		slog.Bool("relaxedCounter", device.RelaxedCounter),
+		slog.String("deviceType", device.DeviceType),
+		slog.Bool("keyWarning", device.KeyWarning),
+		slog.Any("tags", device.Tags),
+	)
+}
+
+// LogValue implements slog.LogValuer. The password is redacted.
+func (m MQTTConfig) LogValue() slog.Value {
+	return slog.AnyValue(redactValue(m.Config()))
+}
+
+// LogValue implements slog.LogValuer. Passwords in the configuration are
+// redacted.
+func (output AppOutput) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("eui", output.EUI),
+		slog.String("appEUI", output.AppEUI),
+		slog.Any("config", redactValue(output.Config)),
+		slog.String("status", output.Status),
+	)
+}
@@ -0,0 +1,95 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogging(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"deviceEUI":"00-01","appKey":"secret-app-key","deviceType":"OTAA"}`))
+	}))
+	defer server.Close()
+
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client, err := NewCongressClient("secret-token", WithAddr(server.URL), WithoutPing(), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+
+	app := &Application{EUI: "00-00", client: client}
+	device := &Device{EUI: "00-01", ApplicationKey: "secret-app-key", NetworkSessionKey: "secret-nwk-key", client: client, app: app}
+	updated, err := device.Update()
+	if err != nil {
+		t.Fatalf("Got error updating device: %v", err)
+	}
+	logger.Info("Updated device", "device", updated)
+	logger.Info("Output", "config", &MQTTConfig{Endpoint: "localhost", Password: "secret-password"})
+
+	out := buf.String()
+	for _, secret := range []string{"secret-token", "secret-app-key", "secret-nwk-key", "secret-password"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("Log output contains %s: %s", secret, out)
+		}
+	}
+	for _, field := range []string{"operation=Device.Update", "method=PUT", "path=/applications/00-00/devices/00-01", "status=200", "duration="} {
+		if !strings.Contains(out, field) {
+			t.Fatalf("Log output doesn't contain %s: %s", field, out)
+		}
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	in := `{"config":{"password":"pw","username":"john"},"nwkSKey":"","list":[{"AppSKey":"key"}]}`
+	out := string(redactJSON([]byte(in)))
+	if strings.Contains(out, `"pw"`) || strings.Contains(out, `"key"`) || !strings.Contains(out, `"john"`) || !strings.Contains(out, `"nwkSKey":""`) {
+		t.Fatalf("Unexpected redacted JSON: %s", out)
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	header := http.Header{}
+	header.Set(tokenHeader, "secret-token")
+	header.Set("Authorization", "Bearer secret-bearer")
+	header.Set("Proxy-Authorization", "Basic secret-proxy")
+	header.Set("Cookie", "session=secret-cookie")
+	header.Set("X-Api-Key", "secret-key")
+	header.Set("Content-Type", "application/json")
+
+	redacted := redactHeader(header)
+	for name := range header {
+		if name == "Content-Type" {
+			continue
+		}
+		if redacted.Get(name) != Redacted {
+			t.Fatalf("Header %s isn't redacted: %v", name, redacted)
+		}
+	}
+	if redacted.Get("Content-Type") != "application/json" {
+		t.Fatalf("Content-Type shouldn't be redacted: %v", redacted)
+	}
+	if header.Get("Authorization") != "Bearer secret-bearer" {
+		t.Fatalf("Original header was modified: %v", header)
+	}
+}
@@ -0,0 +1,95 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"time"
+)
+
+// MetricsObserver receives measurements of API calls and data streams. The
+// congressmetrics package has an implementation that exports them to
+// Prometheus. The methods must be safe for concurrent use.
+type MetricsObserver interface {
+	// ObserveCall is called when an API call is done. The duration
+	// includes retries.
+	ObserveCall(call *Call, err error, duration time.Duration)
+	// ObserveLimiterWait is called when a request has waited for the rate
+	// limiter
+	ObserveLimiterWait(class LimitClass, waited time.Duration)
+	// ObserveStream is called for data stream events
+	ObserveStream(event StreamEvent)
+}
+
+// StreamEvent is an event on a data stream
+type StreamEvent int
+
+const (
+	// StreamReceived is a device data message received on the stream
+	StreamReceived StreamEvent = iota
+	// StreamDropped is a message dropped because the receiver didn't read
+	// it in time
+	StreamDropped
+	// StreamReconnected is a successful reconnect
+	StreamReconnected
+	// StreamDecodeError is a frame that couldn't be decoded
+	StreamDecodeError
+)
+
+func (e StreamEvent) String() string {
+	switch e {
+	case StreamReceived:
+		return "received"
+	case StreamDropped:
+		return "dropped"
+	case StreamReconnected:
+		return "reconnected"
+	case StreamDecodeError:
+		return "decode_error"
+	}
+	return "unknown"
+}
+
+// WithMetrics makes the client report measurements to the observer.
+func WithMetrics(observer MetricsObserver) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.metrics = observer
+	}
+}
+
+// Middleware that reports the call once it is done
+func (c *CongressClient) observeCalls(next Handler) Handler {
+	return func(call *Call) error {
+		start := time.Now()
+		err := next(call)
+		c.metrics.ObserveCall(call, err, time.Since(start))
+		return err
+	}
+}
+
+// The methods below are safe to use when the client has no observer
+
+func (c *CongressClient) limiterWaited(class LimitClass, waited time.Duration) {
+	if c.metrics != nil && waited > 0 {
+		c.metrics.ObserveLimiterWait(class, waited)
+	}
+}
+
+func (c *CongressClient) streamEvent(event StreamEvent) {
+	if c.metrics != nil {
+		c.metrics.ObserveStream(event)
+	}
+}
@@ -0,0 +1,89 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"net/http"
+)
+
+// Call is a single API operation passing through the middleware chain.
+type Call struct {
+	// Operation is the name of the operation, f.e. "Device.EnqueueMessage"
+	Operation string
+	// Request is the HTTP request. Middleware can modify the request before
+	// passing the call on to the next handler. For Application.DataStream
+	// the headers of the request are used when dialing the web socket.
+	Request *http.Request
+	// Result is the entity the response is decoded into. It is nil for
+	// operations without a response body. For Application.DataStream it is
+	// the connection once the web socket is open.
+	Result interface{}
+	// Response is the HTTP response once the request is done. The body has
+	// been consumed when the next handler returns. It is nil for
+	// Application.DataStream and if the request failed.
+	Response *http.Response
+	// Attempts is the number of times the request has been sent, including
+	// retries.
+	Attempts int
+	// Set when the response is decoded into Result
+	decoded bool
+}
+
+// Handler performs a call.
+type Handler func(call *Call) error
+
+// Middleware wraps a handler with additional behaviour. The middleware must
+// call next to perform the call.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware adds middleware to the client. The first middleware is the
+// outermost one and sees the call first.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.chain = append(c.chain, middleware...)
+	}
+}
+
+// WithTracing adds middleware that wraps every call outside the client's
+// logging, metrics and journal so they see the request context it sets.
+// The congresstrace package uses it to add OpenTelemetry spans.
+func WithTracing(middleware Middleware) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.tracing = middleware
+	}
+}
+
+// Run the call through the middleware chain with final as the last handler
+func (c *CongressClient) invoke(call *Call, final Handler) error {
+	h := final
+	for i := len(c.chain) - 1; i >= 0; i-- {
+		h = c.chain[i](h)
+	}
+	if c.journal != nil {
+		h = c.journalCalls(h)
+	}
+	if c.metrics != nil {
+		h = c.observeCalls(h)
+	}
+	if c.logger != nil {
+		h = c.logCalls(h)
+	}
+	if c.tracing != nil {
+		h = c.tracing(h)
+	}
+	return h(call)
+}
@@ -0,0 +1,71 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Correlation-ID") != "1234" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"gateways":[{"gatewayEUI":"00-01"}]}`))
+	}))
+	defer server.Close()
+
+	var trace []string
+	var result interface{}
+	first := func(next Handler) Handler {
+		return func(call *Call) error {
+			trace = append(trace, "first:"+call.Operation)
+			call.Request.Header.Set("X-Correlation-ID", "1234")
+			err := next(call)
+			result = call.Result
+			return err
+		}
+	}
+	second := func(next Handler) Handler {
+		return func(call *Call) error {
+			trace = append(trace, "second:"+call.Operation)
+			return next(call)
+		}
+	}
+
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithMiddleware(first, second))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	gws, err := client.Gateways()
+	if err != nil {
+		t.Fatalf("Got error retrieving gateways: %v", err)
+	}
+	if len(gws) != 1 || gws[0].EUI != "00-01" {
+		t.Fatalf("Unexpected gateway list: %v", gws)
+	}
+	if !reflect.DeepEqual(trace, []string{"first:CongressClient.Gateways", "second:CongressClient.Gateways"}) {
+		t.Fatalf("Middleware called in wrong order: %v", trace)
+	}
+	if list, ok := result.(*gwList); !ok || len(list.Gws) != 1 {
+		t.Fatalf("Middleware didn't see the decoded result: %#v", result)
+	}
+}
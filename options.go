@@ -0,0 +1,83 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option is a configuration option for NewCongressClient.
+type Option func(*CongressClient, *clientConfig)
+
+// Settings that are only used while the client is created
+type clientConfig struct {
+	ping    bool
+	timeout time.Duration
+}
+
+// WithAddr sets the address of the Congress server. The default is DefaultAddr.
+func WithAddr(addr string) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.Addr = addr
+	}
+}
+
+// WithHTTPClient makes the client use a copy of the supplied HTTP client.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.client = *client
+	}
+}
+
+// WithTransport sets the transport used by the HTTP client.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.client.Transport = transport
+	}
+}
+
+// WithTimeout sets the time limit for each request made by the client. The
+// limit includes reading the response body.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithHeader adds a header that is sent with every request. The API token
+// header can't be overridden.
+func WithHeader(name, value string) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.headers.Add(name, value)
+	}
+}
+
+// WithoutPing skips the request to the root resource when the client is
+// created. Use this to create clients while Congress is unavailable.
+func WithoutPing() Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		cfg.ping = false
+	}
+}
@@ -0,0 +1,62 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientOptions(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": "congress"})
+	}))
+	defer server.Close()
+
+	if _, err := NewCongressClient("token", WithAddr("http://127.0.0.1:0"), WithoutPing()); err != nil {
+		t.Fatalf("Got error creating client without ping: %v", err)
+	}
+
+	client, err := NewCongressClient("token",
+		WithAddr(server.URL),
+		WithHTTPClient(&http.Client{}),
+		WithTimeout(time.Second),
+		WithUserAgent("options-test/1.0"),
+		WithHeader("X-Extra", "extra"))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	if client.client.Timeout != time.Second {
+		t.Fatalf("Timeout isn't set. Got %v", client.client.Timeout)
+	}
+	if header.Get("User-Agent") != "options-test/1.0" || header.Get("X-Extra") != "extra" || header.Get(tokenHeader) != "token" {
+		t.Fatalf("Headers aren't set: %v", header)
+	}
+
+	info, err := client.ServerInfo()
+	if err != nil {
+		t.Fatalf("Got error retrieving server info: %v", err)
+	}
+	if info.Addr != server.URL || info.Attributes["name"] != "congress" {
+		t.Fatalf("Unexpected server info: %+v", info)
+	}
+}
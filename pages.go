@@ -0,0 +1,176 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/url"
+	"strconv"
+)
+
+// DefaultPageSize is the number of entities requested per page by the
+// iterators
+const DefaultPageSize = 100
+
+// ErrPagingUnsupported is returned by the iterators when Congress ignores
+// the paging parameters and the rest of the list can't be retrieved.
+var ErrPagingUnsupported = errors.New("paging not supported")
+
+// WithPageSize sets the number of entities requested per page by the
+// iterators.
+func WithPageSize(size int) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.pageSize = size
+	}
+}
+
+// AllApplications iterates over the applications, fetching them a page at a
+// time. If Congress doesn't page the list it is iterated over after one
+// request. The iteration stops at the first error.
+func (c *CongressClient) AllApplications(ctx context.Context) iter.Seq2[Application, error] {
+	return paginate(ctx, c, "CongressClient.Applications", "/applications", "applications", true, func(app *Application) {
+		app.client = c
+		c.trackRevision(app, "")
+	})
+}
+
+// AllGateways iterates over the gateways, fetching them a page at a time.
+// If Congress doesn't page the list it is iterated over after one request.
+// The iteration stops at the first error.
+func (c *CongressClient) AllGateways(ctx context.Context) iter.Seq2[Gateway, error] {
+	return paginate(ctx, c, "CongressClient.Gateways", "/gateways", "gateways", true, func(gw *Gateway) {
+		gw.client = c
+		c.trackRevision(gw, "")
+	})
+}
+
+// AllDevices iterates over the application's devices, fetching them a page
+// at a time. If Congress doesn't page the list it is iterated over after one
+// request. The iteration stops at the first error.
+func (app *Application) AllDevices(ctx context.Context) iter.Seq2[Device, error] {
+	return paginate(ctx, app.client, "Application.Devices", fmt.Sprintf("/applications/%s/devices", app.EUI), "devices", true, func(device *Device) {
+		device.app = app
+		device.client = app.client
+		app.client.trackRevision(device, "")
+	})
+}
+
+// AllMessages iterates over the device's upstream messages, newest first,
+// fetching them a page at a time. The iteration stops at the first error;
+// if Congress ignores the offset the error is ErrPagingUnsupported.
+func (device *Device) AllMessages(ctx context.Context) iter.Seq2[UpstreamMessage, error] {
+	return paginate(ctx, device.client, "Device.Messages", fmt.Sprintf("/applications/%s/devices/%s/data", device.app.EUI, device.EUI), "messages", false, func(*UpstreamMessage) {})
+}
+
+// Iterate over a list resource. Pages are requested with the limit and
+// offset parameters, or the cursor parameter if Congress returns a "next"
+// cursor. If whole is set Congress returns the whole list when it doesn't
+// page it: a response with more than a page is iterated over in full, and
+// if the offset is ignored the list is requested without the paging
+// parameters and the items that have been returned already are skipped.
+// Otherwise the iteration stops with ErrPagingUnsupported in both cases
+// rather than returning a partial list.
+func paginate[T any](ctx context.Context, c *CongressClient, op string, path string, key string, whole bool, prepare func(*T)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		size := c.pageSize
+		if size <= 0 {
+			size = DefaultPageSize
+		}
+		offset := 0
+		cursor := ""
+		var first json.RawMessage
+		for {
+			query := url.Values{"limit": {strconv.Itoa(size)}}
+			if cursor != "" {
+				query.Set("cursor", cursor)
+			} else if offset > 0 {
+				query.Set("offset", strconv.Itoa(offset))
+			}
+			items, next, err := getPage(ctx, c, op, path+"?"+query.Encode(), key)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+
+			paged := len(items) <= size
+			ignored := offset > 0 && len(items) > 0 && bytes.Equal(items[0], first)
+			if !whole && (!paged || ignored) {
+				yield(zero, &CongressError{Message: "Congress ignored the paging parameters", Operation: op, Path: path, Err: ErrPagingUnsupported})
+				return
+			}
+			if ignored {
+				if items, _, err = getPage(ctx, c, op, path, key); err != nil {
+					yield(zero, err)
+					return
+				}
+				items = items[min(offset, len(items)):]
+				paged = false
+			}
+			if len(items) > 0 {
+				first = items[0]
+			}
+			for _, raw := range items {
+				var entity T
+				if err := json.Unmarshal(raw, &entity); err != nil {
+					yield(zero, &CongressError{Message: err.Error(), Operation: op, Path: path, Err: err})
+					return
+				}
+				prepare(&entity)
+				if !yield(entity, nil) {
+					return
+				}
+			}
+
+			switch {
+			case !paged:
+				return
+			case next != "":
+				cursor = next
+			case len(items) < size:
+				return
+			default:
+				offset += len(items)
+			}
+		}
+	}
+}
+
+// Get a page of a list resource. The next cursor is empty if Congress
+// doesn't return one.
+func getPage(ctx context.Context, c *CongressClient, op string, path string, key string) ([]json.RawMessage, string, error) {
+	page, err := genericGet(ctx, c, op, path, &map[string]json.RawMessage{})
+	if err != nil {
+		return nil, "", err
+	}
+	var items []json.RawMessage
+	if raw, ok := (*page)[key]; ok {
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, "", &CongressError{Message: err.Error(), Operation: op, Path: path, Err: err}
+		}
+	}
+	var next string
+	if raw, ok := (*page)["next"]; ok {
+		json.Unmarshal(raw, &next)
+	}
+	return items, next, nil
+}
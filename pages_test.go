@@ -0,0 +1,268 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gregersrygg/gocongress/congresstest"
+)
+
+// Count the requests sent by the client
+func countCalls(count *int) Middleware {
+	return func(next Handler) Handler {
+		return func(call *Call) error {
+			*count++
+			return next(call)
+		}
+	}
+}
+
+func TestPaginatedDevices(t *testing.T) {
+	server := congresstest.NewServer("", congresstest.WithPaging())
+	defer server.Close()
+	requests := 0
+	client, err := NewCongressClient("", WithAddr(server.URL), WithPageSize(10), WithMiddleware(countCalls(&requests)))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		if _, err := app.NewDevice(OTAA); err != nil {
+			t.Fatalf("Got error creating device: %v", err)
+		}
+	}
+
+	requests = 0
+	var euis []string
+	for device, err := range app.AllDevices(context.Background()) {
+		if err != nil {
+			t.Fatalf("Got error iterating devices: %v", err)
+		}
+		if device.client != client || device.app != app {
+			t.Fatal("Device isn't bound to the client")
+		}
+		euis = append(euis, device.EUI)
+	}
+	if requests != 3 {
+		t.Fatalf("Expected 3 requests but got %d", requests)
+	}
+	devices, _ := app.Devices()
+	if len(euis) != len(devices) {
+		t.Fatalf("Expected %d devices but got %d", len(devices), len(euis))
+	}
+	for i := range devices {
+		if devices[i].EUI != euis[i] {
+			t.Fatalf("Device %d is %s but expected %s", i, euis[i], devices[i].EUI)
+		}
+	}
+
+	requests = 0
+	seen := 0
+	for range app.AllDevices(context.Background()) {
+		if seen++; seen == 12 {
+			break
+		}
+	}
+	if requests != 2 {
+		t.Fatalf("Expected 2 requests when stopping early but got %d", requests)
+	}
+
+	device := &devices[0]
+	for i := 0; i < 5; i++ {
+		server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{StringData: fmt.Sprintf("%02x", i)})
+	}
+	var data []string
+	for msg, err := range device.AllMessages(context.Background()) {
+		if err != nil {
+			t.Fatalf("Got error iterating messages: %v", err)
+		}
+		data = append(data, msg.StringData)
+	}
+	if fmt.Sprint(data) != "[04 03 02 01 00]" {
+		t.Fatalf("Unexpected messages: %v", data)
+	}
+}
+
+// Serve gateways with the given paging behaviour
+func gatewayPages(count int, page func(r *http.Request, gws []Gateway) map[string]interface{}) *httptest.Server {
+	gws := make([]Gateway, count)
+	for i := range gws {
+		gws[i] = Gateway{EUI: fmt.Sprintf("00-%02d", i)}
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(page(r, gws))
+	}))
+}
+
+func TestPaginationFallback(t *testing.T) {
+	limit := func(r *http.Request, gws []Gateway) []Gateway {
+		if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n < len(gws) {
+			return gws[:n]
+		}
+		return gws
+	}
+	tests := map[string]struct {
+		page func(r *http.Request, gws []Gateway) map[string]interface{}
+		// The number of gateways returned before the iteration stops
+		count int
+		err   error
+	}{
+		"Unpaged": {func(r *http.Request, gws []Gateway) map[string]interface{} {
+			return map[string]interface{}{"gateways": gws}
+		}, 25, nil},
+		"IgnoredOffset": {func(r *http.Request, gws []Gateway) map[string]interface{} {
+			return map[string]interface{}{"gateways": limit(r, gws)}
+		}, 25, nil},
+		"Cursor": {func(r *http.Request, gws []Gateway) map[string]interface{} {
+			start, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+			ret := map[string]interface{}{"gateways": limit(r, gws[start:])}
+			if end := start + len(limit(r, gws[start:])); end < len(gws) {
+				ret["next"] = strconv.Itoa(end)
+			}
+			return ret
+		}, 25, nil},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := gatewayPages(25, test.page)
+			defer server.Close()
+			client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithPageSize(10))
+			if err != nil {
+				t.Fatalf("Got error creating client: %v", err)
+			}
+			n := 0
+			var iterErr error
+			for gw, err := range client.AllGateways(context.Background()) {
+				if err != nil {
+					iterErr = err
+					break
+				}
+				if gw.EUI != fmt.Sprintf("00-%02d", n) {
+					t.Fatalf("Gateway %d is %s", n, gw.EUI)
+				}
+				n++
+			}
+			if n != test.count || !errors.Is(iterErr, test.err) || (test.err == nil && iterErr != nil) {
+				t.Fatalf("Expected %d gateways and error %v but got %d and %v", test.count, test.err, n, iterErr)
+			}
+		})
+	}
+}
+
+func TestPaginationUnsupported(t *testing.T) {
+	// The server returns whole lists and only honours the limit of the
+	// data history
+	server := congresstest.NewServer("")
+	defer server.Close()
+	requests := 0
+	client, err := NewCongressClient("", WithAddr(server.URL), WithPageSize(10), WithMiddleware(countCalls(&requests)))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	app, err := client.NewApplication()
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		if _, err := app.NewDevice(ABP); err != nil {
+			t.Fatalf("Got error creating device: %v", err)
+		}
+	}
+
+	requests = 0
+	n := 0
+	var device Device
+	for d, err := range app.AllDevices(context.Background()) {
+		if err != nil {
+			t.Fatalf("Got error iterating devices: %v", err)
+		}
+		device = d
+		n++
+	}
+	if n != 25 || requests != 1 {
+		t.Fatalf("Expected 25 devices in 1 request but got %d in %d", n, requests)
+	}
+
+	for i := 0; i < 25; i++ {
+		server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{})
+	}
+	n = 0
+	for _, err := range device.AllMessages(context.Background()) {
+		if err != nil {
+			if !errors.Is(err, ErrPagingUnsupported) {
+				t.Fatalf("Expected paging error but got %v", err)
+			}
+			break
+		}
+		n++
+	}
+	if n != 10 {
+		t.Fatalf("Expected the first page of messages before the error but got %d", n)
+	}
+}
+
+func TestPaginationExactPage(t *testing.T) {
+	// The server returns whole lists and the list fills a page
+	server := congresstest.NewServer("")
+	defer server.Close()
+	requests := 0
+	client, err := NewCongressClient("", WithAddr(server.URL), WithPageSize(3), WithMiddleware(countCalls(&requests)))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := client.NewApplication(); err != nil {
+			t.Fatalf("Got error creating application: %v", err)
+		}
+	}
+
+	requests = 0
+	n := 0
+	for _, err := range client.AllApplications(context.Background()) {
+		if err != nil {
+			t.Fatalf("Got error iterating applications: %v", err)
+		}
+		n++
+	}
+	if n != 3 || requests != 3 {
+		t.Fatalf("Expected 3 applications in 3 requests but got %d in %d", n, requests)
+	}
+}
+
+func TestPaginationError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	client, _ := NewCongressClient("", WithAddr(server.URL), WithoutPing())
+	for _, err := range client.AllApplications(context.Background()) {
+		if ErrorStatusCode(err) != http.StatusForbidden {
+			t.Fatalf("Expected forbidden but got %v", err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInvalidLimitClass is returned by Wait for classes that aren't defined.
+var ErrInvalidLimitClass = errors.New("invalid limit class")
+
+// LimitClass identifies the budget a request is drawn from.
+type LimitClass int
+
+const (
+	// ReadLimit is the budget for GET requests
+	ReadLimit LimitClass = iota
+	// MutationLimit is the budget for POST, PUT and DELETE requests
+	MutationLimit
+	// DownlinkLimit is the budget for downstream messages sent with
+	// EnqueueMessage
+	DownlinkLimit
+
+	numLimitClasses
+)
+
+// String returns the name of the class
+func (l LimitClass) String() string {
+	switch l {
+	case ReadLimit:
+		return "read"
+	case MutationLimit:
+		return "mutation"
+	case DownlinkLimit:
+		return "downlink"
+	default:
+		return "unknown"
+	}
+}
+
+func (l LimitClass) valid() bool {
+	return l >= 0 && l < numLimitClasses
+}
+
+// RateLimit is the rate and burst size of a token bucket. A Rate of zero or
+// less means the requests aren't limited.
+type RateLimit struct {
+	// Rate is the number of requests per second
+	Rate float64
+	// Burst is the number of requests that can be made at once
+	Burst int
+}
+
+// RateLimits holds the budgets for the different kinds of requests.
+type RateLimits struct {
+	Read     RateLimit
+	Mutation RateLimit
+	Downlink RateLimit
+}
+
+// LimiterStats is the wait statistics for a single LimitClass.
+type LimiterStats struct {
+	// Requests is the number of requests that passed the limiter
+	Requests int64
+	// Waits is the number of requests that had to wait
+	Waits int64
+	// WaitTime is the total time spent waiting
+	WaitTime time.Duration
+}
+
+// RateLimiter is a token bucket limiter with separate budgets for reads,
+// mutations and downstream messages. A single limiter can be shared by
+// several clients and is safe for concurrent use.
+type RateLimiter struct {
+	buckets [numLimitClasses]*bucket
+	stats   [numLimitClasses]limiterCounters
+}
+
+type limiterCounters struct {
+	requests int64
+	waits    int64
+	waitTime int64
+}
+
+// NewRateLimiter creates a new rate limiter with the supplied budgets.
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		buckets: [numLimitClasses]*bucket{
+			ReadLimit:     newBucket(limits.Read),
+			MutationLimit: newBucket(limits.Mutation),
+			DownlinkLimit: newBucket(limits.Downlink),
+		},
+	}
+}
+
+// WithRateLimiter makes the client wait for the limiter before each request.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.limiter = limiter
+	}
+}
+
+// Wait blocks until the budget for the class allows another request or the
+// context is done.
+func (l *RateLimiter) Wait(ctx context.Context, class LimitClass) error {
+	_, err := l.wait(ctx, class)
+	return err
+}
+
+// Wait for the budget and return the time spent waiting
+func (l *RateLimiter) wait(ctx context.Context, class LimitClass) (time.Duration, error) {
+	if !class.valid() {
+		return 0, fmt.Errorf("%w: %d", ErrInvalidLimitClass, class)
+	}
+	counters := &l.stats[class]
+	atomic.AddInt64(&counters.requests, 1)
+
+	b := l.buckets[class]
+	if b == nil {
+		return 0, nil
+	}
+	delay := b.reserve(time.Now())
+	if delay <= 0 {
+		return 0, nil
+	}
+	atomic.AddInt64(&counters.waits, 1)
+	start := time.Now()
+	err := sleepContext(ctx, delay)
+	waited := time.Since(start)
+	atomic.AddInt64(&counters.waitTime, int64(waited))
+	if err != nil {
+		b.cancel()
+		atomic.AddInt64(&counters.requests, -1)
+	}
+	return waited, err
+}
+
+// Stats returns the wait statistics for the class. The statistics are empty
+// for classes that aren't defined.
+func (l *RateLimiter) Stats(class LimitClass) LimiterStats {
+	if !class.valid() {
+		return LimiterStats{}
+	}
+	counters := &l.stats[class]
+	return LimiterStats{
+		Requests: atomic.LoadInt64(&counters.requests),
+		Waits:    atomic.LoadInt64(&counters.waits),
+		WaitTime: time.Duration(atomic.LoadInt64(&counters.waitTime)),
+	}
+}
+
+// Find the budget for a request. Downstream messages are posted to the
+// device's message resource.
+func limitClassFor(req *http.Request) LimitClass {
+	switch {
+	case req.Method == http.MethodGet:
+		return ReadLimit
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/message"):
+		return DownlinkLimit
+	default:
+		return MutationLimit
+	}
+}
+
+// A token bucket. The token count goes negative when requests are waiting
+// for tokens.
+type bucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit RateLimit) *bucket {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{rate: limit.Rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Take a token and return the time until it is available
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Return a token that was reserved but not used
+func (b *bucket) cancel() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
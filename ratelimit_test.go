@@ -0,0 +1,88 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(RateLimits{
+		Read:     RateLimit{Rate: 100, Burst: 2},
+		Downlink: RateLimit{Rate: 1, Burst: 1},
+	})
+
+	// The burst passes at once, the rest are spread out
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := limiter.Wait(context.Background(), ReadLimit); err != nil {
+				t.Errorf("Got error waiting for limiter: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("Limiter didn't limit. All requests passed in %v", elapsed)
+	}
+	stats := limiter.Stats(ReadLimit)
+	if stats.Requests != 6 || stats.Waits != 4 || stats.WaitTime <= 0 {
+		t.Fatalf("Unexpected read stats: %+v", stats)
+	}
+
+	// Mutations are unlimited
+	for i := 0; i < 100; i++ {
+		limiter.Wait(context.Background(), MutationLimit)
+	}
+	if stats := limiter.Stats(MutationLimit); stats.Waits != 0 {
+		t.Fatalf("Mutations shouldn't wait: %+v", stats)
+	}
+
+	// The downlink budget is used up by the first request
+	limiter.Wait(context.Background(), DownlinkLimit)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, DownlinkLimit); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded but got %v", err)
+	}
+
+	for _, class := range []LimitClass{-1, numLimitClasses} {
+		if err := limiter.Wait(context.Background(), class); !errors.Is(err, ErrInvalidLimitClass) {
+			t.Fatalf("Expected invalid class error for %d but got %v", class, err)
+		}
+		if stats := limiter.Stats(class); stats != (LimiterStats{}) {
+			t.Fatalf("Expected empty stats for %d but got %+v", class, stats)
+		}
+	}
+}
+
+func TestLimitClass(t *testing.T) {
+	get, _ := http.NewRequest(http.MethodGet, "http://localhost/applications", nil)
+	put, _ := http.NewRequest(http.MethodPut, "http://localhost/applications/1", nil)
+	msg, _ := http.NewRequest(http.MethodPost, "http://localhost/applications/1/devices/2/message", nil)
+	if limitClassFor(get) != ReadLimit || limitClassFor(put) != MutationLimit || limitClassFor(msg) != DownlinkLimit {
+		t.Fatal("Requests are classified incorrectly")
+	}
+}
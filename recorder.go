@@ -0,0 +1,323 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrNoRecording is returned in replay mode when there's no recorded
+// response for a request or stream.
+var ErrNoRecording = errors.New("no recorded response")
+
+// RecorderMode selects if a recorder records or replays
+type RecorderMode int
+
+// Recorder modes
+const (
+	RecordMode RecorderMode = iota
+	ReplayMode
+)
+
+// RecordedRequest is the part of a request used for matching
+type RecordedRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Body   string `json:"body,omitempty"`
+}
+
+// RecordedResponse is a recorded response from Congress
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Interaction is a request and the response it got
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedStream is the frames received on a data stream
+type RecordedStream struct {
+	Path   string   `json:"path"`
+	Frames []string `json:"frames"`
+}
+
+// Fixture is the contents of a recording
+type Fixture struct {
+	Interactions []Interaction    `json:"interactions"`
+	Streams      []RecordedStream `json:"streams,omitempty"`
+}
+
+// Recorder is a http.RoundTripper that records requests and responses to a
+// fixture file, or replays them from the file. The API token is never
+// recorded and device keys are redacted in the bodies. In replay mode
+// requests are matched on method, path and body; identical requests get the
+// recorded responses in order and the last one is repeated when they run
+// out. Use WithRecorder to record data streams as well.
+type Recorder struct {
+	mode      RecorderMode
+	path      string
+	transport http.RoundTripper
+	mutex     sync.Mutex
+	fixture   Fixture
+	used      map[int]bool
+	streams   map[int]bool
+}
+
+// NewRecorder creates a recorder for the fixture file. In replay mode the
+// file is read right away. The transport is used for requests when
+// recording and defaults to http.DefaultTransport.
+func NewRecorder(path string, mode RecorderMode, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	r := &Recorder{
+		mode:      mode,
+		path:      path,
+		transport: transport,
+		used:      make(map[int]bool),
+		streams:   make(map[int]bool),
+	}
+	if mode == ReplayMode {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(buf, &r.fixture); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// WithRecorder sends requests through the recorder and records or replays
+// the data streams.
+func WithRecorder(r *Recorder) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.client.Transport = r
+		c.recorder = r
+	}
+}
+
+// Fixture returns a copy of the recorded interactions
+func (r *Recorder) Fixture() Fixture {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	ret := Fixture{Interactions: append([]Interaction(nil), r.fixture.Interactions...)}
+	for _, stream := range r.fixture.Streams {
+		stream.Frames = append([]string(nil), stream.Frames...)
+		ret.Streams = append(ret.Streams, stream)
+	}
+	return ret
+}
+
+// Save writes the recording to the fixture file
+func (r *Recorder) Save() error {
+	buf, err := json.MarshalIndent(r.Fixture(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(buf, '\n'), 0644)
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == ReplayMode {
+		return r.replay(req, recorded)
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	header.Del(tokenHeader)
+
+	r.mutex.Lock()
+	r.fixture.Interactions = append(r.fixture.Interactions, Interaction{
+		Request: recorded,
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       scrubBody(body, req.Header.Get(tokenHeader)),
+		},
+	})
+	r.mutex.Unlock()
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// Serve the next recorded response that matches the request
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	match := -1
+	for i, interaction := range r.fixture.Interactions {
+		if interaction.Request != recorded {
+			continue
+		}
+		match = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("%w for %s %s", ErrNoRecording, req.Method, recorded.Path)
+	}
+	r.used[match] = true
+	recordedResp := r.fixture.Interactions[match].Response
+	header := recordedResp.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recordedResp.StatusCode, http.StatusText(recordedResp.StatusCode)),
+		StatusCode:    recordedResp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(recordedResp.Body)),
+		ContentLength: int64(len(recordedResp.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Make the matching part of a request. The body is scrubbed the same way as
+// when recording so requests with device keys still match.
+func recordRequest(req *http.Request) (RecordedRequest, error) {
+	ret := RecordedRequest{Method: req.Method, Path: req.URL.RequestURI()}
+	if req.Body == nil || req.Body == http.NoBody {
+		return ret, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return ret, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	ret.Body = scrubBody(body, req.Header.Get(tokenHeader))
+	return ret, nil
+}
+
+// Redact device keys and the API token in a body
+func scrubBody(body []byte, token string) string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return ""
+	}
+	ret := string(redactJSON(body))
+	if token != "" {
+		ret = strings.ReplaceAll(ret, token, Redacted)
+	}
+	return ret
+}
+
+// Check if the recorder replays. Nil recorders don't.
+func (r *Recorder) replaying() bool {
+	return r != nil && r.mode == ReplayMode
+}
+
+// Wrap the connection so the frames are recorded
+func (r *Recorder) recordStream(path string, conn streamConn) streamConn {
+	if r == nil {
+		return conn
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.fixture.Streams = append(r.fixture.Streams, RecordedStream{Path: path, Frames: []string{}})
+	return &recordingConn{streamConn: conn, recorder: r, index: len(r.fixture.Streams) - 1}
+}
+
+// Return a connection with the frames of the next recorded stream for the path
+func (r *Recorder) replayStream(path string) (streamConn, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, stream := range r.fixture.Streams {
+		if stream.Path == path && !r.streams[i] {
+			r.streams[i] = true
+			return &replayConn{frames: stream.Frames}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w for stream %s", ErrNoRecording, path)
+}
+
+// recordingConn adds the received frames to the recording
+type recordingConn struct {
+	streamConn
+	recorder *Recorder
+	index    int
+}
+
+func (c *recordingConn) receive() ([]byte, error) {
+	buf, err := c.streamConn.receive()
+	if err != nil {
+		return buf, err
+	}
+	c.recorder.mutex.Lock()
+	defer c.recorder.mutex.Unlock()
+	stream := &c.recorder.fixture.Streams[c.index]
+	stream.Frames = append(stream.Frames, scrubBody(buf, ""))
+	return buf, nil
+}
+
+// replayConn returns recorded frames and then io.EOF
+type replayConn struct {
+	mutex  sync.Mutex
+	frames []string
+	closed bool
+}
+
+func (c *replayConn) receive() ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed || len(c.frames) == 0 {
+		return nil, io.EOF
+	}
+	frame := c.frames[0]
+	c.frames = c.frames[1:]
+	return []byte(frame), nil
+}
+
+func (c *replayConn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	return nil
+}
@@ -0,0 +1,117 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+// Run the same calls against a server and a replay
+func recorderSession(t *testing.T, client *CongressClient) {
+	app, err := client.GetApplication("00-00")
+	if err != nil {
+		t.Fatalf("Got error retrieving application: %v", err)
+	}
+	device, err := app.GetDevice("00-01")
+	if err != nil {
+		t.Fatalf("Got error retrieving device: %v", err)
+	}
+	if device.ApplicationKey != Redacted && device.ApplicationKey != "secret-appkey" {
+		t.Fatalf("Unexpected key: %s", device.ApplicationKey)
+	}
+	device.ApplicationKey = "secret-appkey"
+	device.SetTag("name", "recorded")
+	if _, err := device.Update(); err != nil {
+		t.Fatalf("Got error updating device: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	data, _, err := app.DataStreamContext(ctx)
+	if err != nil {
+		t.Fatalf("Got error opening stream: %v", err)
+	}
+	var received []string
+	for len(received) < 2 {
+		received = append(received, (<-data).DeviceEUI)
+	}
+	if strings.Join(received, ",") != "00-01,00-02" {
+		t.Fatalf("Unexpected stream data: %v", received)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/applications/00-00", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"applicationEUI":"00-00"}`))
+	})
+	mux.HandleFunc("/applications/00-00/devices/00-01", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"deviceEUI":"00-01","appKey":"secret-appkey","tags":{"token":"secret-token"}}`))
+	})
+	mux.Handle("/applications/00-00/stream", websocket.Handler(func(ws *websocket.Conn) {
+		websocket.Message.Send(ws, `{"type":"DeviceData","data":{"deviceEUI":"00-01"}}`)
+		websocket.Message.Send(ws, `{"type":"DeviceData","data":{"deviceEUI":"00-02"}}`)
+	}))
+	server := httptest.NewServer(mux)
+
+	fixture := filepath.Join(t.TempDir(), "fixture.json")
+	recorder, err := NewRecorder(fixture, RecordMode, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create recorder: %v", err)
+	}
+	client, err := NewCongressClient("secret-token", WithAddr(server.URL), WithoutPing(), WithInsecureStream(), WithRecorder(recorder))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	recorderSession(t, client)
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Couldn't save recording: %v", err)
+	}
+	server.Close()
+
+	buf, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatalf("Couldn't read fixture: %v", err)
+	}
+	if strings.Contains(string(buf), "secret") {
+		t.Fatalf("Fixture contains secrets:\n%s", buf)
+	}
+
+	replayer, err := NewRecorder(fixture, ReplayMode, nil)
+	if err != nil {
+		t.Fatalf("Couldn't load fixture: %v", err)
+	}
+	client, err = NewCongressClient("another-token", WithAddr(server.URL), WithoutPing(), WithRecorder(replayer))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	recorderSession(t, client)
+
+	if _, err := client.GetGateway("00-09"); !errors.Is(err, ErrNoRecording) {
+		t.Fatalf("Expected missing recording but got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried. Requests are retried
+// on network errors, 429 (Too Many Requests) and 5xx responses. Only GET, PUT
+// and DELETE requests are retried unless AllowPostRetry is used on the
+// request context.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// A value of 1 or less disables retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff is the upper limit for the delay between attempts. The
+	// Retry-After header from the server is honoured even if it is longer.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows with for each attempt
+	Multiplier float64
+	// Jitter is the fraction (0-1) of the delay that is randomized
+	Jitter float64
+}
+
+// DefaultRetryPolicy is a reasonable retry policy for most clients.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// WithRetryPolicy makes the client retry failed requests according to the
+// policy. Clients don't retry requests by default.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.retry = policy
+	}
+}
+
+type postRetryKey struct{}
+
+// AllowPostRetry returns a context that permits retries of POST requests
+// such as NewDevice and EnqueueMessage. POST requests aren't idempotent so a
+// retry might create duplicate entities if the original request succeeded
+// but the response was lost.
+func AllowPostRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, postRetryKey{}, true)
+}
+
+// Check if the request can be retried at all
+func (p RetryPolicy) retryable(req *http.Request) bool {
+	if p.MaxAttempts <= 1 {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		allow, _ := req.Context().Value(postRetryKey{}).(bool)
+		return allow
+	}
+	return false
+}
+
+// Check if the result of an attempt should be retried and return the delay
+// before the next attempt. The attempt counter starts at 0.
+func (p RetryPolicy) shouldRetry(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt+1 >= p.MaxAttempts || req.Context().Err() != nil {
+		return 0, false
+	}
+	if err != nil {
+		return p.backoff(attempt), isTransient(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return 0, false
+	}
+	if delay, ok := retryAfter(resp); ok {
+		return delay, true
+	}
+	return p.backoff(attempt), true
+}
+
+// Calculate the backoff for an attempt, including jitter
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	delay := float64(p.InitialBackoff) * math.Pow(mult, float64(attempt))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay -= delay * math.Min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// Read the Retry-After header. The value is either a number of seconds or
+// an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	val := resp.Header.Get("Retry-After")
+	if val == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(val); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(val); err == nil {
+		delay := time.Until(when)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// Check if a network error is likely to go away by itself
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Wait for the duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		switch {
+		case n == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case n == 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"applications":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2, Jitter: 0.5}
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	if _, err := client.Applications(); err != nil {
+		t.Fatalf("Expected request to succeed after retries but got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("Expected 3 attempts but got %d", calls)
+	}
+
+	// POST requests aren't retried by default
+	atomic.StoreInt32(&calls, 1)
+	if _, err := client.NewApplication(); ErrorStatusCode(err) != http.StatusBadGateway {
+		t.Fatalf("Expected 502 for POST without retries but got %v", err)
+	}
+	atomic.StoreInt32(&calls, 1)
+	if _, err := client.NewApplicationContext(AllowPostRetry(context.Background())); err != nil {
+		t.Fatalf("Expected POST to succeed after retry but got %v", err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	if d := policy.backoff(0); d != 100*time.Millisecond {
+		t.Fatalf("Expected 100ms but got %v", d)
+	}
+	if d := policy.backoff(2); d != 400*time.Millisecond {
+		t.Fatalf("Expected 400ms but got %v", d)
+	}
+	if d := policy.backoff(10); d != time.Second {
+		t.Fatalf("Expected backoff to be capped at 1s but got %v", d)
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := policy.backoff(0); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("Jittered backoff out of range: %v", d)
+		}
+	}
+}
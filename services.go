@@ -0,0 +1,196 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"net"
+)
+
+// ApplicationService is the operations on applications, their outputs and
+// their data streams. It is implemented by CongressClient.
+type ApplicationService interface {
+	NewApplicationContext(ctx context.Context) (*Application, error)
+	ApplicationsContext(ctx context.Context) ([]Application, error)
+	GetApplicationContext(ctx context.Context, eui string) (*Application, error)
+	UpdateApplicationContext(ctx context.Context, app *Application) (*Application, error)
+	DeleteApplicationContext(ctx context.Context, eui string) error
+	NewApplicationOutputContext(ctx context.Context, appEUI string, config OutputConfig) (*AppOutput, error)
+	ApplicationOutputsContext(ctx context.Context, appEUI string) ([]AppOutput, error)
+	UpdateApplicationOutputContext(ctx context.Context, appEUI string, output *AppOutput) (*AppOutput, error)
+	DeleteApplicationOutputContext(ctx context.Context, appEUI, eui string) error
+	ApplicationDataStreamContext(ctx context.Context, appEUI string) (chan DataMessage, chan DataErrorMessage, error)
+}
+
+// DeviceService is the operations on devices. Devices are identified by the
+// application EUI and the device EUI. It is implemented by CongressClient.
+type DeviceService interface {
+	NewApplicationDeviceContext(ctx context.Context, appEUI string, dt DeviceType) (*Device, error)
+	ApplicationDevicesContext(ctx context.Context, appEUI string) ([]Device, error)
+	GetApplicationDeviceContext(ctx context.Context, appEUI, eui string) (*Device, error)
+	UpdateApplicationDeviceContext(ctx context.Context, appEUI string, device *Device) (*Device, error)
+	DeleteApplicationDeviceContext(ctx context.Context, appEUI, eui string) error
+	EnqueueDeviceMessageContext(ctx context.Context, appEUI, eui string, data []byte, port uint8, ack bool) (*DownstreamMessage, error)
+	GetQueuedDeviceMessageContext(ctx context.Context, appEUI, eui string) (*DownstreamMessage, error)
+	ClearEnqueuedDeviceMessageContext(ctx context.Context, appEUI, eui string) error
+	DeviceMessagesContext(ctx context.Context, appEUI, eui string, limit int) ([]UpstreamMessage, error)
+}
+
+// GatewayService is the operations on gateways. It is implemented by
+// CongressClient.
+type GatewayService interface {
+	NewGatewayContext(ctx context.Context, eui string, ip net.IP, strict bool, position *Position) (*Gateway, error)
+	GatewaysContext(ctx context.Context) ([]Gateway, error)
+	GetGatewayContext(ctx context.Context, eui string) (*Gateway, error)
+	UpdateGatewayContext(ctx context.Context, gw *Gateway) (*Gateway, error)
+	DeleteGatewayContext(ctx context.Context, eui string) error
+}
+
+var (
+	_ ApplicationService = (*CongressClient)(nil)
+	_ DeviceService      = (*CongressClient)(nil)
+	_ GatewayService     = (*CongressClient)(nil)
+)
+
+// Return an application bound to the client
+func (c *CongressClient) application(eui string) *Application {
+	return &Application{EUI: eui, tagResource: newTags(), client: c}
+}
+
+// Return a device bound to the client
+func (c *CongressClient) device(appEUI, eui string) *Device {
+	return &Device{EUI: eui, tagResource: newTags(), client: c, app: c.application(appEUI)}
+}
+
+// UpdateApplicationContext updates the application in Congress using the
+// provided context
+func (c *CongressClient) UpdateApplicationContext(ctx context.Context, app *Application) (*Application, error) {
+	update := *app
+	update.client = c
+	return update.UpdateContext(ctx)
+}
+
+// DeleteApplicationContext removes the application from Congress using the
+// provided context
+func (c *CongressClient) DeleteApplicationContext(ctx context.Context, eui string) error {
+	return c.application(eui).DeleteContext(ctx)
+}
+
+// NewApplicationOutputContext creates a new output in the application using
+// the provided context
+func (c *CongressClient) NewApplicationOutputContext(ctx context.Context, appEUI string, config OutputConfig) (*AppOutput, error) {
+	return c.application(appEUI).NewOutputContext(ctx, config)
+}
+
+// ApplicationOutputsContext returns the outputs in the application using the
+// provided context
+func (c *CongressClient) ApplicationOutputsContext(ctx context.Context, appEUI string) ([]AppOutput, error) {
+	return c.application(appEUI).OutputsContext(ctx)
+}
+
+// UpdateApplicationOutputContext updates the output in the application using
+// the provided context
+func (c *CongressClient) UpdateApplicationOutputContext(ctx context.Context, appEUI string, output *AppOutput) (*AppOutput, error) {
+	update := *output
+	update.client = c
+	update.app = c.application(appEUI)
+	return update.UpdateContext(ctx)
+}
+
+// DeleteApplicationOutputContext removes the output from the application
+// using the provided context
+func (c *CongressClient) DeleteApplicationOutputContext(ctx context.Context, appEUI, eui string) error {
+	output := &AppOutput{EUI: eui, client: c, app: c.application(appEUI)}
+	return output.DeleteContext(ctx)
+}
+
+// ApplicationDataStreamContext opens the application's data stream. It
+// works like Application.DataStreamContext.
+func (c *CongressClient) ApplicationDataStreamContext(ctx context.Context, appEUI string) (chan DataMessage, chan DataErrorMessage, error) {
+	return c.application(appEUI).DataStreamContext(ctx)
+}
+
+// NewApplicationDeviceContext creates a new device in the application using
+// the provided context
+func (c *CongressClient) NewApplicationDeviceContext(ctx context.Context, appEUI string, dt DeviceType) (*Device, error) {
+	return c.application(appEUI).NewDeviceContext(ctx, dt)
+}
+
+// ApplicationDevicesContext returns the devices in the application using the
+// provided context
+func (c *CongressClient) ApplicationDevicesContext(ctx context.Context, appEUI string) ([]Device, error) {
+	return c.application(appEUI).DevicesContext(ctx)
+}
+
+// GetApplicationDeviceContext returns a device in the application using the
+// provided context
+func (c *CongressClient) GetApplicationDeviceContext(ctx context.Context, appEUI, eui string) (*Device, error) {
+	return c.application(appEUI).GetDeviceContext(ctx, eui)
+}
+
+// UpdateApplicationDeviceContext updates the device in the application using
+// the provided context
+func (c *CongressClient) UpdateApplicationDeviceContext(ctx context.Context, appEUI string, device *Device) (*Device, error) {
+	update := *device
+	update.client = c
+	update.app = c.application(appEUI)
+	return update.UpdateContext(ctx)
+}
+
+// DeleteApplicationDeviceContext removes the device from the application
+// using the provided context
+func (c *CongressClient) DeleteApplicationDeviceContext(ctx context.Context, appEUI, eui string) error {
+	return c.device(appEUI, eui).DeleteContext(ctx)
+}
+
+// EnqueueDeviceMessageContext enqueues a downstream message to the device
+// using the provided context
+func (c *CongressClient) EnqueueDeviceMessageContext(ctx context.Context, appEUI, eui string, data []byte, port uint8, ack bool) (*DownstreamMessage, error) {
+	return c.device(appEUI, eui).EnqueueMessageContext(ctx, data, port, ack)
+}
+
+// GetQueuedDeviceMessageContext returns the message queued for the device
+// using the provided context
+func (c *CongressClient) GetQueuedDeviceMessageContext(ctx context.Context, appEUI, eui string) (*DownstreamMessage, error) {
+	return c.device(appEUI, eui).GetQueuedMessageContext(ctx)
+}
+
+// ClearEnqueuedDeviceMessageContext removes the message queued for the
+// device using the provided context
+func (c *CongressClient) ClearEnqueuedDeviceMessageContext(ctx context.Context, appEUI, eui string) error {
+	return c.device(appEUI, eui).ClearEnqueuedMessageContext(ctx)
+}
+
+// DeviceMessagesContext returns the upstream messages sent from the device
+// using the provided context
+func (c *CongressClient) DeviceMessagesContext(ctx context.Context, appEUI, eui string, limit int) ([]UpstreamMessage, error) {
+	return c.device(appEUI, eui).MessagesContext(ctx, limit)
+}
+
+// UpdateGatewayContext updates the gateway in Congress using the provided
+// context
+func (c *CongressClient) UpdateGatewayContext(ctx context.Context, gw *Gateway) (*Gateway, error) {
+	update := *gw
+	update.client = c
+	return update.UpdateContext(ctx)
+}
+
+// DeleteGatewayContext removes the gateway from Congress using the provided
+// context
+func (c *CongressClient) DeleteGatewayContext(ctx context.Context, eui string) error {
+	return (&Gateway{EUI: eui, tagResource: newTags(), client: c}).DeleteContext(ctx)
+}
@@ -0,0 +1,151 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gregersrygg/gocongress/congresstest"
+)
+
+type services interface {
+	ApplicationService
+	DeviceService
+	GatewayService
+}
+
+func TestServices(t *testing.T) {
+	server := congresstest.NewServer("")
+	defer server.Close()
+	client, err := NewCongressClient("", WithAddr(server.URL), WithInsecureStream())
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	var svc services = client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app, err := svc.NewApplicationContext(ctx)
+	if err != nil {
+		t.Fatalf("Got error creating application: %v", err)
+	}
+	app.SetTag("name", "services")
+	if updated, err := svc.UpdateApplicationContext(ctx, app); err != nil || updated.GetTag("name") != "services" {
+		t.Fatalf("Got error updating application: %v", err)
+	}
+	if got, err := svc.GetApplicationContext(ctx, app.EUI); err != nil || got.GetTag("name") != "services" {
+		t.Fatalf("Couldn't retrieve updated application: %v", err)
+	}
+
+	output, err := svc.NewApplicationOutputContext(ctx, app.EUI, &MQTTConfig{Endpoint: "localhost", Port: 1883})
+	if err != nil {
+		t.Fatalf("Got error creating output: %v", err)
+	}
+	output.Config["port"] = 8883
+	if _, err := svc.UpdateApplicationOutputContext(ctx, app.EUI, output); err != nil {
+		t.Fatalf("Got error updating output: %v", err)
+	}
+	if outputs, err := svc.ApplicationOutputsContext(ctx, app.EUI); err != nil || len(outputs) != 1 || outputs[0].Config["port"] != 8883.0 {
+		t.Fatalf("Unexpected output list %+v (%v)", outputs, err)
+	}
+	if err := svc.DeleteApplicationOutputContext(ctx, app.EUI, output.EUI); err != nil {
+		t.Fatalf("Got error removing output: %v", err)
+	}
+
+	device, err := svc.NewApplicationDeviceContext(ctx, app.EUI, ABP)
+	if err != nil || device.NetworkSessionKey == "" {
+		t.Fatalf("Got error creating device: %+v (%v)", device, err)
+	}
+	device.DeviceAddress = "01020304"
+	if _, err := svc.UpdateApplicationDeviceContext(ctx, app.EUI, device); err != nil {
+		t.Fatalf("Got error updating device: %v", err)
+	}
+	devices, err := svc.ApplicationDevicesContext(ctx, app.EUI)
+	if err != nil || len(devices) != 1 || devices[0].DeviceAddress != "01020304" {
+		t.Fatalf("Unexpected device list %+v (%v)", devices, err)
+	}
+
+	if _, err := svc.EnqueueDeviceMessageContext(ctx, app.EUI, device.EUI, []byte{1, 2}, 0, false); !errors.Is(err, ErrInvalidPort) {
+		t.Fatalf("Expected invalid port but got %v", err)
+	}
+	if _, err := svc.EnqueueDeviceMessageContext(ctx, app.EUI, device.EUI, []byte{1, 2}, 1, false); err != nil {
+		t.Fatalf("Got error enqueuing message: %v", err)
+	}
+	if msg, err := svc.GetQueuedDeviceMessageContext(ctx, app.EUI, device.EUI); err != nil || msg.StringData != "0102" {
+		t.Fatalf("Unexpected queued message %+v (%v)", msg, err)
+	}
+	if err := svc.ClearEnqueuedDeviceMessageContext(ctx, app.EUI, device.EUI); err != nil {
+		t.Fatalf("Got error clearing message: %v", err)
+	}
+	if _, err := svc.GetQueuedDeviceMessageContext(ctx, app.EUI, device.EUI); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected not found but got %v", err)
+	}
+
+	data, _, err := svc.ApplicationDataStreamContext(ctx, app.EUI)
+	if err != nil {
+		t.Fatalf("Got error opening data stream: %v", err)
+	}
+	if err := server.InjectUplink(app.EUI, device.EUI, congresstest.Uplink{StringData: "03"}); err != nil {
+		t.Fatalf("Got error injecting uplink: %v", err)
+	}
+	select {
+	case msg := <-data:
+		if msg.StringData != "03" || msg.DeviceEUI != device.EUI {
+			t.Fatalf("Unexpected message on stream: %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Didn't receive uplink on stream")
+	}
+	if msgs, err := svc.DeviceMessagesContext(ctx, app.EUI, device.EUI, 10); err != nil || len(msgs) != 1 || msgs[0].StringData != "03" {
+		t.Fatalf("Unexpected messages %v (%v)", msgs, err)
+	}
+
+	gw, err := svc.NewGatewayContext(ctx, "00-01-02-03-04-05-06-07", net.ParseIP("127.0.0.1"), false, nil)
+	if err != nil {
+		t.Fatalf("Got error creating gateway: %v", err)
+	}
+	gw.SetTag("name", "services")
+	if _, err := svc.UpdateGatewayContext(ctx, gw); err != nil {
+		t.Fatalf("Got error updating gateway: %v", err)
+	}
+	if gws, err := svc.GatewaysContext(ctx); err != nil || len(gws) != 1 || gws[0].GetTag("name") != "services" {
+		t.Fatalf("Unexpected gateway list %+v (%v)", gws, err)
+	}
+	if err := svc.DeleteGatewayContext(ctx, gw.EUI); err != nil {
+		t.Fatalf("Got error removing gateway: %v", err)
+	}
+	if _, err := svc.GetGatewayContext(ctx, gw.EUI); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected not found but got %v", err)
+	}
+
+	if err := svc.DeleteApplicationDeviceContext(ctx, app.EUI, device.EUI); err != nil {
+		t.Fatalf("Got error removing device: %v", err)
+	}
+	if err := svc.DeleteApplicationContext(ctx, app.EUI); err != nil {
+		t.Fatalf("Got error removing application: %v", err)
+	}
+	if _, err := svc.GetApplicationDeviceContext(ctx, app.EUI, device.EUI); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected not found but got %v", err)
+	}
+	if apps, err := svc.ApplicationsContext(ctx); err != nil || len(apps) != 0 {
+		t.Fatalf("Expected no applications but got %v (%v)", apps, err)
+	}
+}
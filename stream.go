@@ -0,0 +1,243 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// The time to wait for the receiver of the data stream before giving up
+const streamSendTimeout = 400 * time.Millisecond
+
+// DataErrorMessage are error messages generated by the data stream.
+type DataErrorMessage string
+
+// Returned by receive when Congress sends an error frame. The stream is
+// closed without reporting an error.
+var errStreamClosed = errors.New("stream closed by Congress")
+
+// streamConn is a connection that data stream frames are read from
+type streamConn interface {
+	receive() ([]byte, error)
+	Close() error
+}
+
+// socketConn reads frames from a web socket
+type socketConn struct {
+	*websocket.Conn
+}
+
+func (s socketConn) receive() ([]byte, error) {
+	var buf []byte
+	err := websocket.Message.Receive(s.Conn, &buf)
+	return buf, err
+}
+
+// WithStreamReconnect makes data streams reconnect when the web socket
+// fails. The policy controls the delay between attempts and how many
+// consecutive attempts are made before the stream is closed. Errors are
+// still reported on the error channel before reconnecting. Streams that
+// Congress closes with an error frame aren't reconnected.
+func WithStreamReconnect(policy RetryPolicy) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.reconnect = policy
+	}
+}
+
+// WithInsecureStream makes the data stream use an unencrypted ws:// web
+// socket when the client address is an http:// URL, f.e. for a local test
+// server. The data stream always uses wss:// otherwise.
+func WithInsecureStream() Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.wsStream = true
+	}
+}
+
+// DataStream returns a channel with device data using the appliction's web
+// socket. If there's an error reading the web socket the channel will be closed.
+// Error messages are sent on the error channel that is returned.
+func (app *Application) DataStream() (chan DataMessage, chan DataErrorMessage, error) {
+	return app.DataStreamContext(context.Background())
+}
+
+// DataStreamContext works like DataStream but uses the provided context when
+// dialing the web socket. The stream is closed when the context is cancelled.
+func (app *Application) DataStreamContext(ctx context.Context) (chan DataMessage, chan DataErrorMessage, error) {
+	ws, err := app.dialStream(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ret := make(chan DataMessage)
+	errors := make(chan DataErrorMessage)
+	go app.readStream(ctx, ws, ret, errors)
+	return ret, errors, nil
+}
+
+// Open the web socket through the middleware chain
+func (app *Application) dialStream(ctx context.Context) (streamConn, error) {
+	congressURL, err := url.Parse(app.client.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "wss"
+	if congressURL.Scheme == "http" && app.client.wsStream {
+		scheme = "ws"
+	}
+	wscfg, err := websocket.NewConfig(fmt.Sprintf("%s://%s/applications/%s/stream", scheme, congressURL.Host, app.EUI), "http://example.com")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wscfg.Location.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.client.setHeaders(ctx, req.Header); err != nil {
+		return nil, err
+	}
+
+	call := &Call{Operation: "Application.DataStream", Request: req}
+	err = app.client.invoke(call, func(call *Call) error {
+		wscfg.Header = call.Request.Header.Clone()
+		if err := app.client.breaker.allow(call.Request.Context()); err != nil {
+			return wrapError(call, err)
+		}
+		if app.client.recorder.replaying() {
+			ws, err := app.client.recorder.replayStream(call.Request.URL.Path)
+			if err != nil {
+				return wrapError(call, err)
+			}
+			call.Result = ws
+			return nil
+		}
+		ws, err := wscfg.DialContext(call.Request.Context())
+		app.client.breaker.record(call.Request.Context(), nil, err)
+		if err != nil {
+			return wrapError(call, err)
+		}
+		call.Result = app.client.recorder.recordStream(call.Request.URL.Path, socketConn{ws})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return call.Result.(streamConn), nil
+}
+
+// Read from the web socket until it fails or the context is done, then
+// reconnect if the client is configured to do so.
+func (app *Application) readStream(ctx context.Context, ws streamConn, ret chan DataMessage, errors chan DataErrorMessage) {
+	defer close(ret)
+	defer close(errors)
+	for {
+		err := app.receive(ctx, ws, ret)
+		ws.Close()
+		if ctx.Err() != nil || err == errStreamClosed {
+			return
+		}
+		if app.client.reconnect.MaxAttempts <= 1 {
+			select {
+			case errors <- DataErrorMessage(err.Error()):
+			case <-ctx.Done():
+			}
+			return
+		}
+		select {
+		case errors <- DataErrorMessage(err.Error()):
+		case <-ctx.Done():
+			return
+		case <-time.After(streamSendTimeout):
+		}
+		if ws, err = app.redialStream(ctx); err != nil {
+			if ctx.Err() == nil {
+				select {
+				case errors <- DataErrorMessage(err.Error()):
+				case <-ctx.Done():
+				}
+			}
+			return
+		}
+	}
+}
+
+// Try to open the web socket again with the backoff from the reconnect policy
+func (app *Application) redialStream(ctx context.Context) (streamConn, error) {
+	policy := app.client.reconnect
+	var err error
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		if err := sleepContext(ctx, policy.backoff(attempt)); err != nil {
+			return nil, err
+		}
+		var ws streamConn
+		if ws, err = app.dialStream(ctx); err == nil {
+			app.client.streamEvent(StreamReconnected)
+			return ws, nil
+		}
+	}
+	return nil, err
+}
+
+// Receive messages from the web socket until there's an error. The socket is
+// closed if the context is done.
+func (app *Application) receive(ctx context.Context, ws streamConn, ret chan DataMessage) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// Closing the socket unblocks the receive loop below
+		select {
+		case <-ctx.Done():
+			ws.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		buf, err := ws.receive()
+		if err != nil {
+			return err
+		}
+		data := socketData{}
+		if err := json.Unmarshal(buf, &data); err != nil {
+			app.client.streamEvent(StreamDecodeError)
+			return err
+		}
+		switch data.MsgType {
+		case "DeviceData":
+			app.client.streamEvent(StreamReceived)
+			select {
+			case ret <- data.Data:
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(streamSendTimeout):
+				app.client.streamEvent(StreamDropped)
+				return fmt.Errorf("Timed out writing to socket")
+			}
+		case "Error":
+			return errStreamClosed
+		default:
+			// Ignore it
+		}
+	}
+}
@@ -27,6 +27,15 @@ type tagResource struct {
 func newTags() tagResource {
 	return tagResource{Tags: make(map[string]string)}
 }
+
+// Return a copy of the tags
+func copyTags(tags map[string]string) map[string]string {
+	ret := make(map[string]string, len(tags))
+	for k, v := range tags {
+		ret[k] = v
+	}
+	return ret
+}
 func isValidTag(val string) bool {
 	return r.Match([]byte(val))
 }
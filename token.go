@@ -0,0 +1,172 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource supplies the API token for requests. The token is requested
+// for every request and every time a data stream connects so sources can
+// rotate tokens at any time. Implementations must be safe for concurrent use.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenRefresher is implemented by token sources that cache the token. The
+// client calls Refresh when Congress rejects a token with 401 (Unauthorized)
+// before it requests the token again.
+type TokenRefresher interface {
+	Refresh(ctx context.Context) error
+}
+
+// WithTokenSource makes the client get the API token from the source. The
+// token passed to NewCongressClient is ignored.
+func WithTokenSource(source TokenSource) Option {
+	return func(c *CongressClient, cfg *clientConfig) {
+		c.SetTokenSource(source)
+	}
+}
+
+// SetTokenSource replaces the token source of the client. It is safe to call
+// while requests are in flight; requests that are already sent keep the old
+// token.
+func (c *CongressClient) SetTokenSource(source TokenSource) {
+	c.tokens.Store(&tokenHolder{source})
+}
+
+type tokenHolder struct {
+	source TokenSource
+}
+
+// Get the current token
+func (c *CongressClient) token(ctx context.Context) (string, error) {
+	holder := c.tokens.Load()
+	if holder == nil {
+		return c.Token, nil
+	}
+	return holder.source.Token(ctx)
+}
+
+// Refresh the token after it has been rejected. The new token is returned if
+// it is different from the rejected one.
+func (c *CongressClient) refreshToken(ctx context.Context, rejected string) (string, bool) {
+	holder := c.tokens.Load()
+	if holder == nil {
+		return "", false
+	}
+	if refresher, ok := holder.source.(TokenRefresher); ok {
+		if err := refresher.Refresh(ctx); err != nil {
+			return "", false
+		}
+	}
+	token, err := holder.source.Token(ctx)
+	if err != nil || token == rejected {
+		return "", false
+	}
+	return token, true
+}
+
+// StaticToken is a token source that always returns the same token.
+type StaticToken string
+
+// Token returns the token
+func (s StaticToken) Token(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// TokenFunc is a token source that calls the function for every token.
+type TokenFunc func(ctx context.Context) (string, error)
+
+// Token calls the function
+func (f TokenFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// EnvToken is a token source that reads the token from the environment
+// variable with the name every time it is used.
+type EnvToken string
+
+// Token returns the value of the environment variable
+func (e EnvToken) Token(ctx context.Context) (string, error) {
+	token := strings.TrimSpace(os.Getenv(string(e)))
+	if token == "" {
+		return "", fmt.Errorf("environment variable %s is not set", string(e))
+	}
+	return token, nil
+}
+
+// FileToken is a token source that reads the token from a file. The file is
+// read again when its modification time changes.
+type FileToken struct {
+	path    string
+	mutex   sync.Mutex
+	token   string
+	modTime time.Time
+}
+
+// NewFileToken creates a token source for the file. Leading and trailing
+// white space in the file is ignored.
+func NewFileToken(path string) *FileToken {
+	return &FileToken{path: path}
+}
+
+// Token returns the token in the file
+func (f *FileToken) Token(ctx context.Context) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+	if f.token != "" && info.ModTime().Equal(f.modTime) {
+		return f.token, nil
+	}
+	return f.read(info.ModTime())
+}
+
+// Refresh reads the file even if the modification time is unchanged
+func (f *FileToken) Refresh(ctx context.Context) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	_, err = f.read(info.ModTime())
+	return err
+}
+
+// Read the file. The mutex must be held.
+func (f *FileToken) read(modTime time.Time) (string, error) {
+	buf, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(buf))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", f.path)
+	}
+	f.token = token
+	f.modTime = modTime
+	return token, nil
+}
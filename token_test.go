@@ -0,0 +1,91 @@
+package gocongress
+
+/*
+**   Copyright 2017 Telenor Digital AS
+**
+**  Licensed under the Apache License, Version 2.0 (the "License");
+**  you may not use this file except in compliance with the License.
+**  You may obtain a copy of the License at
+**
+**      http://www.apache.org/licenses/LICENSE-2.0
+**
+**  Unless required by applicable law or agreed to in writing, software
+**  distributed under the License is distributed on an "AS IS" BASIS,
+**  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+**  See the License for the specific language governing permissions and
+**  limitations under the License.
+ */
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTokenRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(tokenHeader) != "new-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"gateways":[]}`))
+	}))
+	defer server.Close()
+
+	var calls int32
+	source := TokenFunc(func(ctx context.Context) (string, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return "old-token", nil
+		}
+		return "new-token", nil
+	})
+	client, err := NewCongressClient("", WithAddr(server.URL), WithoutPing(), WithTokenSource(source))
+	if err != nil {
+		t.Fatalf("Got error creating client: %v", err)
+	}
+	if _, err := client.Gateways(); err != nil {
+		t.Fatalf("Expected request to succeed with refreshed token but got %v", err)
+	}
+
+	// A static token can't be refreshed
+	client.SetTokenSource(StaticToken("old-token"))
+	if _, err := client.Gateways(); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Expected ErrUnauthorized but got %v", err)
+	}
+}
+
+func TestFileToken(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(name, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	source := NewFileToken(name)
+	if token, err := source.Token(context.Background()); err != nil || token != "first" {
+		t.Fatalf("Expected first token but got %q (%v)", token, err)
+	}
+	if err := os.WriteFile(name, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Refresh(context.Background()); err != nil {
+		t.Fatalf("Got error refreshing token: %v", err)
+	}
+	if token, _ := source.Token(context.Background()); token != "second" {
+		t.Fatalf("Expected second token but got %q", token)
+	}
+}
+
+func TestEnvToken(t *testing.T) {
+	t.Setenv("GOCONGRESS_TEST_TOKEN", "env-token")
+	if token, err := EnvToken("GOCONGRESS_TEST_TOKEN").Token(context.Background()); err != nil || token != "env-token" {
+		t.Fatalf("Expected env-token but got %q (%v)", token, err)
+	}
+	t.Setenv("GOCONGRESS_TEST_TOKEN", "")
+	if _, err := EnvToken("GOCONGRESS_TEST_TOKEN").Token(context.Background()); err == nil {
+		t.Fatal("Expected error for empty environment variable")
+	}
+}